@@ -70,6 +70,31 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ConstStatement const语句 （const <标识符> = <表达式>） 绑定后不允许重新赋值
+type ConstStatement struct {
+	Token token.Token // CONST
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode() {}
+
+func (cs *ConstStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 // ReturnStatement return语句 （return <表达式>）
 type ReturnStatement struct {
 	Token       token.Token // RETURN
@@ -84,9 +109,31 @@ func (rs *ReturnStatement) TokenLiteral() string {
 
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
-	out.WriteString(rs.TokenLiteral() + " ")
+	out.WriteString(rs.TokenLiteral())
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+// DeferStatement defer语句 （defer <表达式>） 函数返回时才执行表达式
+type DeferStatement struct {
+	Token      token.Token // DEFER
+	Expression Expression
+}
+
+func (ds *DeferStatement) statementNode() {}
+
+func (ds *DeferStatement) TokenLiteral() string {
+	return ds.Token.Literal
+}
+
+func (ds *DeferStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ds.TokenLiteral() + " ")
+	if ds.Expression != nil {
+		out.WriteString(ds.Expression.String())
 	}
 	out.WriteString(";")
 	return out.String()
@@ -163,6 +210,22 @@ func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral 小数表达式 let x = 3.14;
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
 // StringLiteral 字符串表达式 let x = "abc";
 type StringLiteral struct {
 	Token token.Token
@@ -226,6 +289,23 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// MemberExpression 成员访问 <表达式>.<标识符>，相当于用标识符名作为字符串键访问哈希
+type MemberExpression struct {
+	Token    token.Token // .
+	Object   Expression
+	Property *Identifier
+}
+
+func (me *MemberExpression) expressionNode() {}
+
+func (me *MemberExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
+func (me *MemberExpression) String() string {
+	return "(" + me.Object.String() + "." + me.Property.String() + ")"
+}
+
 // HashLiteral 哈希表达式 {<表达式>:<表达式>,<表达式>:<表达式>}
 type HashLiteral struct {
 	Token token.Token
@@ -266,10 +346,27 @@ func (b *Boolean) String() string {
 	return b.Token.Literal
 }
 
+// Null 空值表达式 let x = null;
+type Null struct {
+	Token token.Token
+}
+
+func (n *Null) expressionNode() {}
+
+func (n *Null) TokenLiteral() string {
+	return n.Token.Literal
+}
+
+func (n *Null) String() string {
+	return n.Token.Literal
+}
+
 // FunctionLiteral 函数表达式 let x = fn(<参数>){<函数体>}
 type FunctionLiteral struct {
 	Token      token.Token     // FUNCTION
 	Parameters []*Identifier   // 参数
+	Defaults   []Expression    // 参数的默认值，与Parameters一一对应，没有默认值的是nil
+	Rest       *Identifier     // 可变参数 fn(a, ...rest)，没有时是nil
 	Body       *BlockStatement // 函数体
 }
 
@@ -282,9 +379,16 @@ func (fl *FunctionLiteral) TokenLiteral() string {
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := make([]string, 0)
-	for _, param := range fl.Parameters {
+	for i, param := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, param.String()+" = "+fl.Defaults[i].String())
+			continue
+		}
 		params = append(params, param.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
+	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
@@ -320,6 +424,117 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// WhileExpression while循环表达式 while (<条件表达式>) {<循环体>}
+type WhileExpression struct {
+	Token     token.Token // WHILE
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (we *WhileExpression) expressionNode() {}
+
+func (we *WhileExpression) TokenLiteral() string {
+	return we.Token.Literal
+}
+
+func (we *WhileExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("while")
+	out.WriteString(we.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(we.Body.String())
+	return out.String()
+}
+
+// ForInStatement for-in循环 for (<变量> in <数组或哈希>) {<循环体>}
+type ForInStatement struct {
+	Token    token.Token // FOR
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode() {}
+
+func (fs *ForInStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+	return out.String()
+}
+
+// TernaryExpression 三元表达式 <条件> ? <成立表达式> : <否则表达式>
+type TernaryExpression struct {
+	Token       token.Token // ?
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (te *TernaryExpression) expressionNode() {}
+
+func (te *TernaryExpression) TokenLiteral() string {
+	return te.Token.Literal
+}
+
+func (te *TernaryExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(te.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(te.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(te.Alternative.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// AssignExpression 赋值表达式 <标识符> = <表达式>
+type AssignExpression struct {
+	Token token.Token // =
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString(ae.Name.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+	return out.String()
+}
+
+// PostfixExpression 后缀表达式 <标识符>++ <标识符>--
+type PostfixExpression struct {
+	Token    token.Token // ++ 或 --
+	Name     *Identifier
+	Operator string
+}
+
+func (pe *PostfixExpression) expressionNode() {}
+
+func (pe *PostfixExpression) TokenLiteral() string {
+	return pe.Token.Literal
+}
+
+func (pe *PostfixExpression) String() string {
+	return "(" + pe.Name.String() + pe.Operator + ")"
+}
+
 // CallExpression 函数调用表达式 add(1,1+2) fn(x,y){x+y;}(2,3) calls(2,3,fn(x,y){x+y}) <表达式>(<逗号分隔的表达式>)
 type CallExpression struct {
 	Token     token.Token
@@ -368,6 +583,32 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+// ComparisonChain 连续比较 a < b <= c，等价于 a < b && b <= c，每个运算数只求值一次
+type ComparisonChain struct {
+	Token     token.Token // 第一个比较运算符
+	Operands  []Expression
+	Operators []string // 比运算数少一个
+}
+
+func (cc *ComparisonChain) expressionNode() {}
+
+func (cc *ComparisonChain) TokenLiteral() string {
+	return cc.Token.Literal
+}
+
+func (cc *ComparisonChain) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	for i, operand := range cc.Operands {
+		if i > 0 {
+			out.WriteString(" " + cc.Operators[i-1] + " ")
+		}
+		out.WriteString(operand.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
 // InfixExpression 中缀表达式
 type InfixExpression struct {
 	Token    token.Token
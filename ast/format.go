@@ -0,0 +1,304 @@
+package ast
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// indentUnit 每层缩进的空格
+const indentUnit = "  "
+
+// Format 把语法树格式化成源码，每条语句单独一行，大括号里的内容每层缩进两个空格
+// 与String()不同，只在必要的地方加括号，格式化后的源码重新解析能得到相同的语法树
+func Format(node Node) string {
+	f := &formatter{}
+	f.node(node)
+	return f.out.String()
+}
+
+type formatter struct {
+	out   bytes.Buffer
+	level int // 当前缩进层数
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+}
+
+func (f *formatter) indent() {
+	f.write(strings.Repeat(indentUnit, f.level))
+}
+
+func (f *formatter) node(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for i, s := range node.Statements {
+			if i > 0 {
+				f.write("\n")
+			}
+			f.statement(s)
+		}
+	case Statement:
+		f.statement(node)
+	case Expression:
+		f.expression(node)
+	}
+}
+
+func (f *formatter) statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		f.write("let " + stmt.Name.Value + " = ")
+		f.expression(stmt.Value)
+		f.write(";")
+	case *ConstStatement:
+		f.write("const " + stmt.Name.Value + " = ")
+		f.expression(stmt.Value)
+		f.write(";")
+	case *ReturnStatement:
+		f.write("return")
+		if !isNilNode(stmt.ReturnValue) {
+			f.write(" ")
+			f.expression(stmt.ReturnValue)
+		}
+		f.write(";")
+	case *DeferStatement:
+		f.write("defer ")
+		f.expression(stmt.Expression)
+		f.write(";")
+	case *ExpressionStatement:
+		f.expression(stmt.Expression)
+		// 以大括号结尾的if、while后面不加分号
+		switch stmt.Expression.(type) {
+		case *IfExpression, *WhileExpression:
+		default:
+			f.write(";")
+		}
+	case *ForInStatement:
+		f.write("for (" + stmt.Variable.Value + " in ")
+		f.expression(stmt.Iterable)
+		f.write(") ")
+		f.block(stmt.Body)
+	case *BlockStatement:
+		f.block(stmt)
+	}
+}
+
+func (f *formatter) block(block *BlockStatement) {
+	if isNilNode(block) || len(block.Statements) == 0 {
+		f.write("{}")
+		return
+	}
+	f.write("{\n")
+	f.level++
+	for _, s := range block.Statements {
+		f.indent()
+		f.statement(s)
+		f.write("\n")
+	}
+	f.level--
+	f.indent()
+	f.write("}")
+}
+
+func (f *formatter) expression(exp Expression) {
+	if isNilNode(exp) {
+		return
+	}
+	switch exp := exp.(type) {
+	case *StringLiteral:
+		f.write(`"` + exp.Value + `"`)
+	case *ArrayLiteral:
+		f.write("[")
+		for i, el := range exp.Elements {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(el)
+		}
+		f.write("]")
+	case *HashLiteral:
+		keys := make([]Expression, 0, len(exp.Pairs))
+		for k := range exp.Pairs {
+			keys = append(keys, k)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		f.write("{")
+		for i, k := range keys {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(k)
+			f.write(": ")
+			f.expression(exp.Pairs[k])
+		}
+		f.write("}")
+	case *IndexExpression:
+		f.operand(exp.Left, callPrecedence)
+		f.write("[")
+		f.expression(exp.Index)
+		f.write("]")
+	case *MemberExpression:
+		f.operand(exp.Object, callPrecedence)
+		f.write("." + exp.Property.Value)
+	case *CallExpression:
+		f.operand(exp.Function, callPrecedence)
+		f.write("(")
+		for i, arg := range exp.Arguments {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.expression(arg)
+		}
+		f.write(")")
+	case *FunctionLiteral:
+		f.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				f.write(", ")
+			}
+			f.write(param.Value)
+			if i < len(exp.Defaults) && !isNilNode(exp.Defaults[i]) {
+				f.write(" = ")
+				f.expression(exp.Defaults[i])
+			}
+		}
+		if !isNilNode(exp.Rest) {
+			if len(exp.Parameters) > 0 {
+				f.write(", ")
+			}
+			f.write("..." + exp.Rest.Value)
+		}
+		f.write(") ")
+		f.block(exp.Body)
+	case *IfExpression:
+		f.write("if (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Consequence)
+		if !isNilNode(exp.Alternative) {
+			f.write(" else ")
+			f.block(exp.Alternative)
+		}
+	case *WhileExpression:
+		f.write("while (")
+		f.expression(exp.Condition)
+		f.write(") ")
+		f.block(exp.Body)
+	case *TernaryExpression:
+		// 条件里的三元表达式必须加括号，否则会被解析成右结合
+		f.operand(exp.Condition, ternaryPrecedence+1)
+		f.write(" ? ")
+		f.expression(exp.Consequence)
+		f.write(" : ")
+		f.operand(exp.Alternative, ternaryPrecedence)
+	case *AssignExpression:
+		f.write(exp.Name.Value + " = ")
+		// 赋值是右结合的，右边的赋值不需要括号
+		f.expression(exp.Value)
+	case *PrefixExpression:
+		f.write(exp.Operator)
+		f.operand(exp.Right, prefixPrecedence)
+	case *PostfixExpression:
+		f.write(exp.Name.Value + exp.Operator)
+	case *InfixExpression:
+		precedence := infixPrecedence(exp.Operator)
+		leftPrecedence := precedence
+		if precedence == lessGreaterPrecedence {
+			// 不加括号的 a < b < c 会被解析成连续比较
+			leftPrecedence++
+		}
+		// 中缀运算都是左结合的，右边优先级相同时也要加括号
+		f.operand(exp.Left, leftPrecedence)
+		f.write(" " + exp.Operator + " ")
+		f.operand(exp.Right, precedence+1)
+	case *ComparisonChain:
+		for i, operand := range exp.Operands {
+			if i > 0 {
+				f.write(" " + exp.Operators[i-1] + " ")
+			}
+			f.operand(operand, lessGreaterPrecedence+1)
+		}
+	default:
+		f.write(exp.String())
+	}
+}
+
+// operand 作为运算数输出，优先级低于minPrecedence时加括号
+func (f *formatter) operand(exp Expression, minPrecedence int) {
+	if expressionPrecedence(exp) < minPrecedence {
+		f.write("(")
+		f.expression(exp)
+		f.write(")")
+		return
+	}
+	f.expression(exp)
+}
+
+// 与parser中的优先级顺序一致
+const (
+	_ int = iota
+	lowestPrecedence
+	assignPrecedence
+	ternaryPrecedence
+	bitOrPrecedence
+	bitXorPrecedence
+	bitAndPrecedence
+	equalsPrecedence
+	lessGreaterPrecedence
+	sumPrecedence
+	shiftPrecedence
+	productPrecedence
+	prefixPrecedence
+	postfixPrecedence
+	callPrecedence
+)
+
+func infixPrecedence(operator string) int {
+	switch operator {
+	case "|":
+		return bitOrPrecedence
+	case "^":
+		return bitXorPrecedence
+	case "&":
+		return bitAndPrecedence
+	case "==", "!=":
+		return equalsPrecedence
+	case "<", ">", "<=", ">=":
+		return lessGreaterPrecedence
+	case "+", "-":
+		return sumPrecedence
+	case "<<", ">>":
+		return shiftPrecedence
+	case "*", "/":
+		return productPrecedence
+	default:
+		return lowestPrecedence
+	}
+}
+
+// expressionPrecedence 表达式最外层运算的优先级，字面量、标识符这类不会被拆开的表达式优先级最高
+func expressionPrecedence(exp Expression) int {
+	switch exp := exp.(type) {
+	case *AssignExpression:
+		return assignPrecedence
+	case *TernaryExpression:
+		return ternaryPrecedence
+	case *InfixExpression:
+		return infixPrecedence(exp.Operator)
+	case *ComparisonChain:
+		return lessGreaterPrecedence
+	case *PrefixExpression:
+		return prefixPrecedence
+	case *PostfixExpression:
+		return postfixPrecedence
+	case *IfExpression, *WhileExpression, *FunctionLiteral:
+		// 作为运算数时加上括号更容易阅读，比如 (fn(x) { x })(1)
+		return lowestPrecedence
+	default:
+		return callPrecedence + 1
+	}
+}
@@ -0,0 +1,71 @@
+package ast_test
+
+import (
+	"interpreter/ast"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	input := `let fib = fn(n) { if (n < 2) { return n; } else { let a = fib(n - 1); return a + fib(n - 2); } };
+let i = 0; while (i < 3) { if (i == 1) { puts("one"); } i = i + 1; }
+let h = {"b": [1, 2 * (3 + 4)], "a": fn() {}};
+defer puts((1 + 2) * -3, !(true == false), (a - b) - (c - d));`
+
+	expected := `let fib = fn(n) {
+  if (n < 2) {
+    return n;
+  } else {
+    let a = fib(n - 1);
+    return a + fib(n - 2);
+  }
+};
+let i = 0;
+while (i < 3) {
+  if (i == 1) {
+    puts("one");
+  }
+  i = i + 1;
+}
+let h = {"a": fn() {}, "b": [1, 2 * (3 + 4)]};
+defer puts((1 + 2) * -3, !(true == false), a - b - (c - d));`
+
+	got := ast.Format(parse(t, input))
+	if got != expected {
+		t.Errorf("Format wrong.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := []string{
+		`let x = a * (b + c) - d / (e - f);`,
+		`a = b = c + 1;`,
+		`(fn(x) { x * 2 })(3)[0];`,
+		`-(a + b) * -c;`,
+		`let y = if (x) { 1 } else { 2 } + 3;`,
+		`f(g(1), [h[0], {1: null}]);`,
+		`const c = a <= b == (c >= d);`,
+		`let f = fn(a, b = a * 2, c = fn(x = 1) { x }) { a + b };`,
+		`let g = fn(a, ...rest) { rest }; let h = fn(...all) { all };`,
+		`let m = (a ? b : c) ? d : e ? f : g;`,
+		`x = a > b ? y = 1 : (z = 2);`,
+		`let b = (x & 1) == 0 | a ^ b & c << 2 + 1;`,
+		`let s = (a | b) & (c ^ d) >> (e << f);`,
+		`let n = ~(a | b) & ~-c;`,
+		`user.profile.name + (a + b).c + f(x).y[0].z();`,
+		`let d = -(-i--) - -j++ * 2;`,
+		`let e = --x - -(-y) + f(--z);`,
+		`for (x in [1, 2]) { for (k in h) { puts(x, k); } }`,
+		`let c = 1 < a + 1 <= b == (a < b) > 0;`,
+		`let d = (a < b) < c < (d >= e);`,
+	}
+
+	for _, input := range tests {
+		original := parse(t, input)
+		formatted := ast.Format(original)
+		reparsed := parse(t, formatted)
+		if reparsed.String() != original.String() {
+			t.Errorf("round trip changed the program.\ninput:    %s\nformatted:%s\nwant=%s\ngot=%s",
+				input, formatted, original.String(), reparsed.String())
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// ToJSON 把语法树序列化为JSON，每个节点都有"type"字段标明节点类型，以及"line"、"column"标明所在位置
+// 缺失的子节点（比如没有else）输出为null，哈希字面量的键值对按键的字符串形式排序后输出为数组
+func ToJSON(node Node) ([]byte, error) {
+	tree, err := toJSONValue(node)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// toJSONValue 把节点转换成可以直接交给encoding/json的map
+func toJSONValue(node Node) (interface{}, error) {
+	if isNilNode(node) {
+		return nil, nil
+	}
+	var (
+		fields = make(map[string]interface{})
+		err    error
+	)
+	// set 转换子节点并写入字段，出错后跳过剩余的子节点
+	set := func(name string, child Node) {
+		if err != nil {
+			return
+		}
+		fields[name], err = toJSONValue(child)
+	}
+	setList := func(name string, count int, child func(i int) Node) {
+		list := make([]interface{}, count)
+		for i := range list {
+			if err != nil {
+				return
+			}
+			list[i], err = toJSONValue(child(i))
+		}
+		fields[name] = list
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		fields["type"] = "Program"
+		setList("statements", len(node.Statements), func(i int) Node { return node.Statements[i] })
+		// Program没有自己的token，不输出位置
+		return fields, err
+	case *LetStatement:
+		fields["type"] = "LetStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("name", node.Name)
+		set("value", node.Value)
+	case *ConstStatement:
+		fields["type"] = "ConstStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("name", node.Name)
+		set("value", node.Value)
+	case *ReturnStatement:
+		fields["type"] = "ReturnStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("returnValue", node.ReturnValue)
+	case *DeferStatement:
+		fields["type"] = "DeferStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("expression", node.Expression)
+	case *ExpressionStatement:
+		fields["type"] = "ExpressionStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("expression", node.Expression)
+	case *BlockStatement:
+		fields["type"] = "BlockStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		setList("statements", len(node.Statements), func(i int) Node { return node.Statements[i] })
+	case *Identifier:
+		fields["type"] = "Identifier"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["value"] = node.Value
+	case *IntegerLiteral:
+		fields["type"] = "IntegerLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["value"] = node.Value
+	case *FloatLiteral:
+		fields["type"] = "FloatLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["value"] = node.Value
+	case *StringLiteral:
+		fields["type"] = "StringLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["value"] = node.Value
+	case *Boolean:
+		fields["type"] = "Boolean"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["value"] = node.Value
+	case *Null:
+		fields["type"] = "Null"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+	case *ArrayLiteral:
+		fields["type"] = "ArrayLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		setList("elements", len(node.Elements), func(i int) Node { return node.Elements[i] })
+	case *IndexExpression:
+		fields["type"] = "IndexExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("left", node.Left)
+		set("index", node.Index)
+	case *MemberExpression:
+		fields["type"] = "MemberExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("object", node.Object)
+		set("property", node.Property)
+	case *HashLiteral:
+		fields["type"] = "HashLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		keys := make([]Expression, 0, len(node.Pairs))
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		pairs := make([]interface{}, len(keys))
+		for i, k := range keys {
+			pair := make(map[string]interface{})
+			if pair["key"], err = toJSONValue(k); err != nil {
+				return nil, err
+			}
+			if pair["value"], err = toJSONValue(node.Pairs[k]); err != nil {
+				return nil, err
+			}
+			pairs[i] = pair
+		}
+		fields["pairs"] = pairs
+	case *FunctionLiteral:
+		fields["type"] = "FunctionLiteral"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		setList("parameters", len(node.Parameters), func(i int) Node { return node.Parameters[i] })
+		// 与parameters一一对应，没有默认值的是null
+		setList("defaults", len(node.Parameters), func(i int) Node {
+			if i < len(node.Defaults) {
+				return node.Defaults[i]
+			}
+			return nil
+		})
+		set("rest", node.Rest)
+		set("body", node.Body)
+	case *IfExpression:
+		fields["type"] = "IfExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("condition", node.Condition)
+		set("consequence", node.Consequence)
+		set("alternative", node.Alternative)
+	case *WhileExpression:
+		fields["type"] = "WhileExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("condition", node.Condition)
+		set("body", node.Body)
+	case *ForInStatement:
+		fields["type"] = "ForInStatement"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("variable", node.Variable)
+		set("iterable", node.Iterable)
+		set("body", node.Body)
+	case *TernaryExpression:
+		fields["type"] = "TernaryExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("condition", node.Condition)
+		set("consequence", node.Consequence)
+		set("alternative", node.Alternative)
+	case *AssignExpression:
+		fields["type"] = "AssignExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("name", node.Name)
+		set("value", node.Value)
+	case *CallExpression:
+		fields["type"] = "CallExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("function", node.Function)
+		setList("arguments", len(node.Arguments), func(i int) Node { return node.Arguments[i] })
+	case *PrefixExpression:
+		fields["type"] = "PrefixExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		fields["operator"] = node.Operator
+		set("right", node.Right)
+	case *PostfixExpression:
+		fields["type"] = "PostfixExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("name", node.Name)
+		fields["operator"] = node.Operator
+	case *InfixExpression:
+		fields["type"] = "InfixExpression"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		set("left", node.Left)
+		fields["operator"] = node.Operator
+		set("right", node.Right)
+	case *ComparisonChain:
+		fields["type"] = "ComparisonChain"
+		setPosition(fields, node.Token.Line, node.Token.Column)
+		setList("operands", len(node.Operands), func(i int) Node { return node.Operands[i] })
+		fields["operators"] = node.Operators
+	default:
+		return nil, fmt.Errorf("无法序列化的节点类型: %T", node)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func setPosition(fields map[string]interface{}, line, column int) {
+	fields["line"] = line
+	fields["column"] = column
+}
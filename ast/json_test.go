@@ -0,0 +1,117 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"interpreter/ast"
+	"reflect"
+	"testing"
+)
+
+func TestToJSON(t *testing.T) {
+	program := parse(t, "let x = fn(a) { if (a > 1) { a } };\nx({\"k\": [1, -2]})[0];")
+
+	data, err := ast.ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, data)
+	}
+
+	// 解码后再编码应得到完全相同的结果，说明所有字段都是普通的JSON值
+	again, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatalf("re-marshal failed: %s", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON does not round-trip.\nfirst =%s\nsecond=%s", data, again)
+	}
+
+	stmts := tree["statements"].([]interface{})
+	if len(stmts) != 2 {
+		t.Fatalf("statements length wrong. got=%d", len(stmts))
+	}
+
+	let := stmts[0].(map[string]interface{})
+	expectFields(t, let, map[string]interface{}{"type": "LetStatement", "line": 1.0, "column": 1.0})
+	expectFields(t, let["name"].(map[string]interface{}), map[string]interface{}{"type": "Identifier", "value": "x"})
+
+	fn := let["value"].(map[string]interface{})
+	expectFields(t, fn, map[string]interface{}{"type": "FunctionLiteral", "line": 1.0, "column": 9.0})
+	ifExp := fn["body"].(map[string]interface{})["statements"].([]interface{})[0].(map[string]interface{})["expression"].(map[string]interface{})
+	expectFields(t, ifExp, map[string]interface{}{"type": "IfExpression", "alternative": nil})
+	expectFields(t, ifExp["condition"].(map[string]interface{}), map[string]interface{}{"type": "InfixExpression", "operator": ">"})
+
+	index := stmts[1].(map[string]interface{})["expression"].(map[string]interface{})
+	expectFields(t, index, map[string]interface{}{"type": "IndexExpression", "line": 2.0})
+	call := index["left"].(map[string]interface{})
+	hash := call["arguments"].([]interface{})[0].(map[string]interface{})
+	pair := hash["pairs"].([]interface{})[0].(map[string]interface{})
+	expectFields(t, pair["key"].(map[string]interface{}), map[string]interface{}{"type": "StringLiteral", "value": "k"})
+	elements := pair["value"].(map[string]interface{})["elements"].([]interface{})
+	expectFields(t, elements[1].(map[string]interface{}), map[string]interface{}{"type": "PrefixExpression", "operator": "-"})
+}
+
+func TestToJSONMissingChildren(t *testing.T) {
+	data, err := ast.ToJSON(&ast.ReturnStatement{})
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	expected := `{"column":0,"line":0,"returnValue":null,"type":"ReturnStatement"}`
+	if string(data) != expected {
+		t.Errorf("JSON wrong. want=%s, got=%s", expected, data)
+	}
+}
+
+func expectFields(t *testing.T, node map[string]interface{}, expected map[string]interface{}) {
+	t.Helper()
+	for field, want := range expected {
+		got, ok := node[field]
+		if !ok {
+			t.Errorf("field %q missing in %v", field, node)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("field %q wrong. want=%v, got=%v", field, want, got)
+		}
+	}
+}
+
+func TestToJSONMemberExpression(t *testing.T) {
+	data, err := ast.ToJSON(parse(t, "user.name"))
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, data)
+	}
+	member := tree["statements"].([]interface{})[0].(map[string]interface{})["expression"].(map[string]interface{})
+	expectFields(t, member, map[string]interface{}{"type": "MemberExpression", "line": 1.0, "column": 5.0})
+	expectFields(t, member["object"].(map[string]interface{}), map[string]interface{}{"type": "Identifier", "value": "user"})
+	expectFields(t, member["property"].(map[string]interface{}), map[string]interface{}{"type": "Identifier", "value": "name"})
+}
+
+func TestToJSONComparisonChain(t *testing.T) {
+	data, err := ast.ToJSON(parse(t, "1 < x <= 3"))
+	if err != nil {
+		t.Fatalf("ToJSON returned error: %s", err)
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, data)
+	}
+	chain := tree["statements"].([]interface{})[0].(map[string]interface{})["expression"].(map[string]interface{})
+	expectFields(t, chain, map[string]interface{}{"type": "ComparisonChain", "line": 1.0, "column": 3.0})
+	operands := chain["operands"].([]interface{})
+	if len(operands) != 3 {
+		t.Fatalf("operands length wrong. got=%d", len(operands))
+	}
+	expectFields(t, operands[1].(map[string]interface{}), map[string]interface{}{"type": "Identifier", "value": "x"})
+	operators := chain["operators"].([]interface{})
+	if len(operators) != 2 || operators[0] != "<" || operators[1] != "<=" {
+		t.Errorf("operators wrong. got=%v", operators)
+	}
+}
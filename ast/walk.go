@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Walk 深度优先遍历语法树，先访问节点本身，visit返回true时再按源码顺序递归访问子节点
+// visit返回false时跳过该节点的所有子节点，但不影响它的兄弟节点
+func Walk(node Node, visit func(Node) bool) {
+	if isNilNode(node) || !visit(node) {
+		return
+	}
+	for _, child := range children(node) {
+		Walk(child, visit)
+	}
+}
+
+// children 节点的直接子节点，缺失的可选部分（比如没有else）不会出现在结果里
+func children(node Node) []Node {
+	var nodes []Node
+	add := func(ns ...Node) {
+		for _, n := range ns {
+			if !isNilNode(n) {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *LetStatement:
+		add(node.Name, node.Value)
+	case *ConstStatement:
+		add(node.Name, node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *DeferStatement:
+		add(node.Expression)
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *MemberExpression:
+		add(node.Object, node.Property)
+	case *HashLiteral:
+		// map的遍历顺序不固定，按键的字符串形式排序，保证每次遍历的顺序一致
+		keys := make([]Expression, 0, len(node.Pairs))
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		for _, k := range keys {
+			add(k, node.Pairs[k])
+		}
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			add(param)
+			if i < len(node.Defaults) {
+				add(node.Defaults[i])
+			}
+		}
+		add(node.Rest, node.Body)
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *WhileExpression:
+		add(node.Condition, node.Body)
+	case *ForInStatement:
+		add(node.Variable, node.Iterable, node.Body)
+	case *TernaryExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *AssignExpression:
+		add(node.Name, node.Value)
+	case *CallExpression:
+		add(node.Function)
+		for _, arg := range node.Arguments {
+			add(arg)
+		}
+	case *PrefixExpression:
+		add(node.Right)
+	case *PostfixExpression:
+		add(node.Name)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *ComparisonChain:
+		for _, operand := range node.Operands {
+			add(operand)
+		}
+	}
+	return nodes
+}
+
+// isNilNode 解析出错时子节点可能是nil，包括装在接口里的nil指针
+func isNilNode(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
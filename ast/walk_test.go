@@ -0,0 +1,129 @@
+package ast_test
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/lexer"
+	"interpreter/parser"
+	"testing"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has %d errors: %q", len(p.Errors()), p.Errors())
+	}
+	return program
+}
+
+func TestWalkCountsNodes(t *testing.T) {
+	input := `
+let add = fn(a, b) { return a + b; };
+const limit = 10;
+let result = if (add(1, 2) < limit) { [1, "two", true][0] } else { null };
+let h = {"one": 1, "two": -2};
+while (result < 3) { result = result + 1; }
+defer puts(h["one"]);
+`
+	program := parse(t, input)
+
+	counts := make(map[string]int)
+	ast.Walk(program, func(node ast.Node) bool {
+		counts[fmt.Sprintf("%T", node)]++
+		return true
+	})
+
+	expected := map[string]int{
+		"*ast.Program":             1,
+		"*ast.LetStatement":        3,
+		"*ast.ConstStatement":      1,
+		"*ast.ReturnStatement":     1,
+		"*ast.DeferStatement":      1,
+		"*ast.ExpressionStatement": 4,
+		"*ast.BlockStatement":      4,
+		"*ast.Identifier":          15,
+		"*ast.IntegerLiteral":      9,
+		"*ast.StringLiteral":       4,
+		"*ast.Boolean":             1,
+		"*ast.Null":                1,
+		"*ast.ArrayLiteral":        1,
+		"*ast.IndexExpression":     2,
+		"*ast.HashLiteral":         1,
+		"*ast.FunctionLiteral":     1,
+		"*ast.IfExpression":        1,
+		"*ast.WhileExpression":     1,
+		"*ast.AssignExpression":    1,
+		"*ast.CallExpression":      2,
+		"*ast.PrefixExpression":    1,
+		"*ast.InfixExpression":     4,
+	}
+	for typ, want := range expected {
+		if counts[typ] != want {
+			t.Errorf("count of %s wrong. want=%d, got=%d", typ, want, counts[typ])
+		}
+	}
+	for typ := range counts {
+		if _, ok := expected[typ]; !ok {
+			t.Errorf("unexpected node type visited: %s", typ)
+		}
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	program := parse(t, `add(x, 1 * 2)`)
+
+	var visited []string
+	ast.Walk(program, func(node ast.Node) bool {
+		if _, ok := node.(ast.Expression); ok {
+			visited = append(visited, node.String())
+		}
+		return true
+	})
+
+	expected := []string{"add(x, (1 * 2))", "add", "x", "(1 * 2)", "1", "2"}
+	if fmt.Sprint(visited) != fmt.Sprint(expected) {
+		t.Errorf("visit order wrong. want=%q, got=%q", expected, visited)
+	}
+}
+
+func TestWalkPruning(t *testing.T) {
+	program := parse(t, `let f = fn(x) { let y = x * 2; y }; let z = f(1);`)
+
+	var identifiers []string
+	ast.Walk(program, func(node ast.Node) bool {
+		// 不进入函数体，只统计顶层的标识符
+		if _, ok := node.(*ast.FunctionLiteral); ok {
+			return false
+		}
+		if ident, ok := node.(*ast.Identifier); ok {
+			identifiers = append(identifiers, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"f", "z", "f"}
+	if fmt.Sprint(identifiers) != fmt.Sprint(expected) {
+		t.Errorf("identifiers wrong. want=%q, got=%q", expected, identifiers)
+	}
+}
+
+func TestWalkSkipsMissingChildren(t *testing.T) {
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ReturnStatement{},
+		&ast.ExpressionStatement{Expression: &ast.IfExpression{
+			Condition:   &ast.Boolean{Value: true},
+			Consequence: &ast.BlockStatement{},
+		}},
+	}}
+
+	count := 0
+	ast.Walk(program, func(node ast.Node) bool {
+		count++
+		return true
+	})
+	// Program ReturnStatement ExpressionStatement IfExpression Boolean BlockStatement
+	if count != 6 {
+		t.Errorf("visited node count wrong. want=6, got=%d", count)
+	}
+}
@@ -1,28 +1,46 @@
 package evaluator
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"interpreter/lexer"
 	"interpreter/object"
+	"interpreter/parser"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var builtins = map[string]*object.Builtin{
 	"len": {
-		func(args ...object.Object) object.Object {
+		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("入参数量不正确，需要1个，实际%d个", len(args))
 			}
 			switch arg := args[0].(type) {
 			case *object.String:
-				return &object.Integer{Value: int64(len(arg.Value))}
+				// 与字符串下标一致按字符计数，而不是字节数
+				return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
 			default:
 				return newError("len不支持的参数类型，%s", args[0].Type())
 			}
 		},
 	},
 	"first": {
-		func(args ...object.Object) object.Object {
+		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("入参数量不正确，需要1个，实际%d个", len(args))
 			}
@@ -37,7 +55,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": {
-		func(args ...object.Object) object.Object {
+		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("入参数量不正确，需要1个，实际%d个", len(args))
 			}
@@ -54,7 +72,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": {
-		func(args ...object.Object) object.Object {
+		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("入参数量不正确，需要1个，实际%d个", len(args))
 			}
@@ -72,7 +90,7 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": {
-		func(args ...object.Object) object.Object {
+		Fn: func(args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("入参数量不正确，需要2个，实际%d个", len(args))
 			}
@@ -87,12 +105,1728 @@ var builtins = map[string]*object.Builtin{
 			return &object.Array{Elements: newElements}
 		},
 	},
-	"puts": {
-		func(args ...object.Object) object.Object {
+	"pop": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("pop不支持的参数类型，%s", args[0].Type())
+			}
+			length := len(arr.Elements)
+			if length == 0 {
+				return NULL
+			}
+			// 不修改原数组，返回 [最后一个元素, 去掉最后一个元素的新数组]
+			newElements := make([]object.Object, length-1)
+			copy(newElements, arr.Elements[:length-1])
+			return &object.Array{Elements: []object.Object{
+				arr.Elements[length-1],
+				&object.Array{Elements: newElements},
+			}}
+		},
+	},
+	"remove": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("remove不支持的参数类型，%s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("remove不支持的参数类型，%s", args[1].Type())
+			}
+			// 与push、rest一致，不修改原数组而是返回新数组
+			length := int64(len(arr.Elements))
+			if index.Value < 0 || index.Value >= length {
+				return newError("remove的下标越界: %d，数组长度为%d", index.Value, length)
+			}
+			elements := make([]object.Object, 0, length-1)
+			elements = append(elements, arr.Elements[:index.Value]...)
+			elements = append(elements, arr.Elements[index.Value+1:]...)
+			return &object.Array{Elements: elements}
+		},
+	},
+	"insert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("入参数量不正确，需要3个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("insert不支持的参数类型，%s", args[0].Type())
+			}
+			index, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("insert不支持的参数类型，%s", args[1].Type())
+			}
+			// 下标等于数组长度时相当于push
+			length := int64(len(arr.Elements))
+			if index.Value < 0 || index.Value > length {
+				return newError("insert的下标越界: %d，数组长度为%d", index.Value, length)
+			}
+			elements := make([]object.Object, 0, length+1)
+			elements = append(elements, arr.Elements[:index.Value]...)
+			elements = append(elements, args[2])
+			elements = append(elements, arr.Elements[index.Value:]...)
+			return &object.Array{Elements: elements}
+		},
+	},
+	"keys": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("keys不支持的参数类型，%s", args[0].Type())
+			}
+			pairs := sortedPairs(hash)
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Key
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"entries": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("entries不支持的参数类型，%s", args[0].Type())
+			}
+			// 与keys、values的顺序一致，每一项是 [键, 值]
+			pairs := sortedPairs(hash)
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"values": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("values不支持的参数类型，%s", args[0].Type())
+			}
+			pairs := sortedPairs(hash)
+			elements := make([]object.Object, len(pairs))
+			for i, pair := range pairs {
+				elements[i] = pair.Value
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"delete": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			hash, ok := args[0].(*object.Hash)
+			if !ok {
+				return newError("delete不支持的参数类型，%s", args[0].Type())
+			}
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("无法作为哈希的键, %s", args[1].Type())
+			}
+			deleted := key.HashKey()
+			// 和push、rest一样不修改原哈希，返回新的哈希
+			newPairs := make(map[object.HashKey]object.HashPair, len(hash.Pairs))
+			for hashKey, pair := range hash.Pairs {
+				if hashKey != deleted {
+					newPairs[hashKey] = pair
+				}
+			}
+			return &object.Hash{Pairs: newPairs}
+		},
+	},
+	"type": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			return &object.String{Value: string(args[0].Type())}
+		},
+	},
+	"is_null":   typePredicate(object.NULL_OBJ),
+	"is_error":  typePredicate(object.ERROR_OBJ),
+	"is_array":  typePredicate(object.ARRAY_OBJ),
+	"is_string": typePredicate(object.STRING_OBJ),
+	"is_int":    typePredicate(object.INTEGER_OBJ),
+	"is_fn":     typePredicate(object.FUNCTION_OBJ, object.BUILTIN_OBJ),
+	"int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Integer:
+				return arg
+			case *object.String:
+				// 只接受十进制整数，"3.5"这种小数也视为无法转换
+				value, err := strconv.ParseInt(arg.Value, 10, 64)
+				if err != nil {
+					return newError("无法将 %q 转换为整数", arg.Value)
+				}
+				return &object.Integer{Value: value}
+			default:
+				return newError("int不支持的参数类型，%s", args[0].Type())
+			}
+		},
+	},
+	"parse_int": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("parse_int不支持的参数类型，%s", args[0].Type())
+			}
+			base, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("parse_int不支持的参数类型，%s", args[1].Type())
+			}
+			if base.Value < 2 || base.Value > 36 {
+				return newError("进制必须在2到36之间，实际是%d", base.Value)
+			}
+			if str.Value == "" {
+				return newError("parse_int的字符串不能为空")
+			}
+			// 字母不区分大小写，可以有正负号，但不接受0x这类前缀
+			value, err := strconv.ParseInt(str.Value, int(base.Value), 64)
+			if err != nil {
+				if errors.Is(err, strconv.ErrRange) {
+					return newError("整数超出范围: %q", str.Value)
+				}
+				return newError("无法将 %q 按%d进制转换为整数", str.Value, base.Value)
+			}
+			return newInteger(value)
+		},
+	},
+	"to_json": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			value, errObj := jsonValue(args[0])
+			if errObj != nil {
+				return errObj
+			}
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			// 保留字符串里的<、>、&，不转义成\u003c这种形式
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(value); err != nil {
+				return newError("to_json失败: %s", err)
+			}
+			return &object.String{Value: strings.TrimSuffix(buf.String(), "\n")}
+		},
+	},
+	"from_json": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("from_json不支持的参数类型，%s", args[0].Type())
+			}
+			decoder := json.NewDecoder(strings.NewReader(str.Value))
+			// 保留数字的原文，再决定是整数还是小数
+			decoder.UseNumber()
+			var value interface{}
+			if err := decoder.Decode(&value); err != nil {
+				return newError("from_json解析失败: %s", err)
+			}
+			if _, err := decoder.Token(); err != io.EOF {
+				return newError("from_json解析失败: JSON后面有多余的内容")
+			}
+			return fromJSONValue(value)
+		},
+	},
+	"str": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			if str, ok := args[0].(*object.String); ok {
+				return str
+			}
+			return &object.String{Value: args[0].Inspect()}
+		},
+	},
+	"split": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("split不支持的参数类型，%s", args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("split不支持的参数类型，%s", args[1].Type())
+			}
+			// 分隔符为空时按rune拆成单个字符，多字节的UTF-8字符不会被截断
+			parts := strings.Split(str.Value, sep.Value)
+			elements := make([]object.Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &object.String{Value: part}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"join": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("join不支持的参数类型，%s", args[0].Type())
+			}
+			sep, ok := args[1].(*object.String)
+			if !ok {
+				return newError("join不支持的参数类型，%s", args[1].Type())
+			}
+			parts := make([]string, len(arr.Elements))
+			for i, el := range arr.Elements {
+				str, ok := el.(*object.String)
+				if !ok {
+					return newError("join的数组元素必须是字符串，第%d个是%s", i+1, el.Type())
+				}
+				parts[i] = str.Value
+			}
+			return &object.String{Value: strings.Join(parts, sep.Value)}
+		},
+	},
+	"contains": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			switch collection := args[0].(type) {
+			case *object.Array:
+				// 数字、字符串、布尔按值比较，其余按指针比较
+				for _, el := range collection.Elements {
+					if sameKey(el, args[1]) {
+						return TRUE
+					}
+				}
+				return FALSE
+			case *object.String:
+				sub, ok := args[1].(*object.String)
+				if !ok {
+					return newError("contains不支持的参数类型，%s", args[1].Type())
+				}
+				return nativeBoolToBooleanObject(strings.Contains(collection.Value, sub.Value))
+			case *object.Hash:
+				// 不能作为键的值不可能在哈希里，但这多半是写错了，所以报错而不是返回false
+				key, ok := args[1].(object.Hashable)
+				if !ok {
+					return newError("无法作为哈希的键, %s", args[1].Type())
+				}
+				_, ok = collection.Pairs[key.HashKey()]
+				return nativeBoolToBooleanObject(ok)
+			default:
+				return newError("contains不支持的参数类型，%s", args[0].Type())
+			}
+		},
+	},
+	"commafy": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("入参数量不正确，需要1到2个，实际%d个", len(args))
+			}
+			num, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("commafy不支持的参数类型，%s", args[0].Type())
+			}
+			sep := ","
+			if len(args) == 2 {
+				sepStr, ok := args[1].(*object.String)
+				if !ok {
+					return newError("commafy不支持的参数类型，%s", args[1].Type())
+				}
+				sep = sepStr.Value
+			}
+			return &object.String{Value: commafy(num.Value, sep)}
+		},
+	},
+	"abs": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			switch num := args[0].(type) {
+			case *object.Integer:
+				// 最小的int64取反后会溢出回自身，返回错误而不是给出一个负数
+				if num.Value == math.MinInt64 {
+					return newError("abs结果溢出: %d", num.Value)
+				}
+				if num.Value < 0 {
+					return newInteger(-num.Value)
+				}
+				return num
+			case *object.Float:
+				return &object.Float{Value: math.Abs(num.Value)}
+			default:
+				return newError("abs不支持的参数类型，%s", args[0].Type())
+			}
+		},
+	},
+	"min": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("min", args, numberLess)
+		},
+	},
+	"max": {
+		Fn: func(args ...object.Object) object.Object {
+			return extremum("max", args, func(a, b object.Object) bool { return numberLess(b, a) })
+		},
+	},
+	"sum": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("sum不支持的参数类型，%s", args[0].Type())
+			}
+			// 整数部分单独累加，全是整数时结果不受float64精度的影响
+			var total int64
+			var floatTotal float64
+			hasFloat := false
+			for i, el := range arr.Elements {
+				switch num := el.(type) {
+				case *object.Integer:
+					total += num.Value
+				case *object.Float:
+					floatTotal += num.Value
+					hasFloat = true
+				default:
+					return newError("sum的数组元素必须是数字，第%d个是%s", i+1, el.Type())
+				}
+			}
+			if hasFloat {
+				return &object.Float{Value: float64(total) + floatTotal}
+			}
+			return newInteger(total)
+		},
+	},
+	"upper": {
+		Fn: func(args ...object.Object) object.Object {
+			return mapString("upper", args, strings.ToUpper)
+		},
+	},
+	"lower": {
+		Fn: func(args ...object.Object) object.Object {
+			return mapString("lower", args, strings.ToLower)
+		},
+	},
+	"trim": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("入参数量不正确，需要1到2个，实际%d个", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("trim不支持的参数类型，%s", args[0].Type())
+			}
+			if len(args) == 1 {
+				return &object.String{Value: strings.TrimSpace(str.Value)}
+			}
+			// cutset里的每个字符都会从两端去掉，而不是当作一个整体的前后缀
+			cutset, ok := args[1].(*object.String)
+			if !ok {
+				return newError("trim不支持的参数类型，%s", args[1].Type())
+			}
+			return &object.String{Value: strings.Trim(str.Value, cutset.Value)}
+		},
+	},
+	"starts_with": {
+		Fn: func(args ...object.Object) object.Object {
+			return matchString("starts_with", args, strings.HasPrefix)
+		},
+	},
+	"ends_with": {
+		Fn: func(args ...object.Object) object.Object {
+			return matchString("ends_with", args, strings.HasSuffix)
+		},
+	},
+	"replace": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return newError("入参数量不正确，需要3个，实际%d个", len(args))
+			}
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				str, ok := arg.(*object.String)
+				if !ok {
+					return newError("replace不支持的参数类型，%s", arg.Type())
+				}
+				strs[i] = str.Value
+			}
+			// old为空时与strings.ReplaceAll一致，在开头和每个字符之后都插入new
+			return &object.String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+		},
+	},
+	"index_of": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
+			switch collection := args[0].(type) {
+			case *object.Array:
+				// 与contains一致，数字、字符串、布尔按值比较，其余按指针比较
+				for i, el := range collection.Elements {
+					if sameKey(el, args[1]) {
+						return newInteger(int64(i))
+					}
+				}
+				return newInteger(-1)
+			case *object.String:
+				sub, ok := args[1].(*object.String)
+				if !ok {
+					return newError("index_of不支持的参数类型，%s", args[1].Type())
+				}
+				// 与字符串索引一致，返回的是字符（rune）的位置而不是字节的位置
+				idx := strings.Index(collection.Value, sub.Value)
+				if idx < 0 {
+					return newInteger(-1)
+				}
+				return newInteger(int64(utf8.RuneCountInString(collection.Value[:idx])))
+			default:
+				return newError("index_of不支持的参数类型，%s", args[0].Type())
+			}
+		},
+	},
+	"slice": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("入参数量不正确，需要2到3个，实际%d个", len(args))
+			}
+			var length int
+			switch collection := args[0].(type) {
+			case *object.Array:
+				length = len(collection.Elements)
+			case *object.String:
+				length = utf8.RuneCountInString(collection.Value)
+			default:
+				return newError("slice不支持的参数类型，%s", args[0].Type())
+			}
+			start, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("slice不支持的参数类型，%s", args[1].Type())
+			}
+			from, to := clampIndex(start.Value, length), length
+			if len(args) == 3 {
+				end, ok := args[2].(*object.Integer)
+				if !ok {
+					return newError("slice不支持的参数类型，%s", args[2].Type())
+				}
+				to = clampIndex(end.Value, length)
+			}
+			if to < from {
+				to = from
+			}
+			switch collection := args[0].(type) {
+			case *object.Array:
+				elements := make([]object.Object, to-from)
+				copy(elements, collection.Elements[from:to])
+				return &object.Array{Elements: elements}
+			default:
+				// 按rune切分，多字节字符不会被截断
+				runes := []rune(collection.(*object.String).Value)
+				return &object.String{Value: string(runes[from:to])}
+			}
+		},
+	},
+	"format": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) == 0 {
+				return newError("入参数量不正确，至少需要1个，实际0个")
+			}
+			template, ok := args[0].(*object.String)
+			if !ok {
+				return newError("format不支持的参数类型，%s", args[0].Type())
+			}
+			return format(template.Value, args[1:])
+		},
+	},
+	"sqrt": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			if !isNumber(args[0]) {
+				return newError("sqrt不支持的参数类型，%s", args[0].Type())
+			}
+			value := toFloat(args[0])
+			if value < 0 {
+				return newError("sqrt的参数不能为负数: %s", args[0].Inspect())
+			}
+			return &object.Float{Value: math.Sqrt(value)}
+		},
+	},
+	"pow": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("入参数量不正确，需要2个，实际%d个", len(args))
+			}
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				if !isNumber(arg) {
+					return newError("pow不支持的参数类型，%s", arg.Type())
+				}
 			}
-			return NULL
+			base, baseOk := args[0].(*object.Integer)
+			exp, expOk := args[1].(*object.Integer)
+			if baseOk && expOk && exp.Value >= 0 {
+				if result, ok := powInt(base.Value, exp.Value); ok {
+					return newInteger(result)
+				}
+			}
+			// 负数次方、有小数参与或者整数结果溢出时返回小数
+			return &object.Float{Value: math.Pow(toFloat(args[0]), toFloat(args[1]))}
+		},
+	},
+	"ord": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			str, ok := args[0].(*object.String)
+			if !ok {
+				return newError("ord不支持的参数类型，%s", args[0].Type())
+			}
+			// 按rune计算，多字节的UTF-8字符返回它的码点
+			if utf8.RuneCountInString(str.Value) != 1 {
+				return newError("ord需要恰好一个字符，实际%d个", utf8.RuneCountInString(str.Value))
+			}
+			r, _ := utf8.DecodeRuneInString(str.Value)
+			return newInteger(int64(r))
+		},
+	},
+	"chr": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("chr不支持的参数类型，%s", args[0].Type())
+			}
+			// 负数、超过最大码点以及代理区的码点都不是合法字符
+			if code.Value < 0 || code.Value > utf8.MaxRune || !utf8.ValidRune(rune(code.Value)) {
+				return newError("无效的码点: %d", code.Value)
+			}
+			return &object.String{Value: string(rune(code.Value))}
 		},
 	},
+	"floor": {
+		Fn: func(args ...object.Object) object.Object {
+			return roundFloat("floor", args, math.Floor)
+		},
+	},
+	"ceil": {
+		Fn: func(args ...object.Object) object.Object {
+			return roundFloat("ceil", args, math.Ceil)
+		},
+	},
+	"round": {
+		Fn: func(args ...object.Object) object.Object {
+			// math.Round 的一半远离零取整，round(-2.5) 是 -3
+			return roundFloat("round", args, math.Round)
+		},
+	},
+	"assert": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("入参数量不正确，需要1到2个，实际%d个", len(args))
+			}
+			var message *object.String
+			if len(args) == 2 {
+				str, ok := args[1].(*object.String)
+				if !ok {
+					return newError("assert不支持的参数类型，%s", args[1].Type())
+				}
+				message = str
+			}
+			// 与if一致按真值判断
+			if isTruthy(args[0]) {
+				return NULL
+			}
+			if message != nil {
+				return newError("断言失败: %s", message.Value)
+			}
+			return newError("断言失败")
+		},
+	},
+	"unique": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("unique不支持的参数类型，%s", args[0].Type())
+			}
+			// 与contains一致，数字、字符串、布尔按值去重，其余的只有同一个对象才算重复
+			seen := make(map[interface{}]bool)
+			elements := make([]object.Object, 0, len(arr.Elements))
+			for _, el := range arr.Elements {
+				key := uniqueKey(el)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				elements = append(elements, el)
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"zip": {
+		Fn: func(args ...object.Object) object.Object {
+			// zip(a, b, ...) 第i项是各数组第i个元素组成的数组，长度以最短的数组为准
+			if len(args) < 2 {
+				return newError("入参数量不正确，至少需要2个，实际%d个", len(args))
+			}
+			arrays := make([]*object.Array, len(args))
+			length := -1
+			for i, arg := range args {
+				arr, ok := arg.(*object.Array)
+				if !ok {
+					return newError("zip不支持的参数类型，%s", arg.Type())
+				}
+				arrays[i] = arr
+				if length < 0 || len(arr.Elements) < length {
+					length = len(arr.Elements)
+				}
+			}
+			elements := make([]object.Object, length)
+			for i := range elements {
+				tuple := make([]object.Object, len(arrays))
+				for j, arr := range arrays {
+					tuple[j] = arr.Elements[i]
+				}
+				elements[i] = &object.Array{Elements: tuple}
+			}
+			return &object.Array{Elements: elements}
+		},
+	},
+	"exit": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("入参数量不正确，需要0到1个，实际%d个", len(args))
+			}
+			// 不调用os.Exit，避免把嵌入解释器的宿主程序也结束掉，由评估的调用方决定如何退出
+			if len(args) == 0 {
+				return &object.Exit{Code: 0}
+			}
+			code, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("exit不支持的参数类型，%s", args[0].Type())
+			}
+			return &object.Exit{Code: code.Value}
+		},
+	},
+	"clone": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			return deepCopy(args[0])
+		},
+	},
+}
+
+// sortedPairs 哈希的键值对，按键的Inspect排序（相同时再按类型），保证遍历顺序稳定
+func sortedPairs(hash *object.Hash) []object.HashPair {
+	pairs := make([]object.HashPair, 0, len(hash.Pairs))
+	for _, pair := range hash.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		ki, kj := pairs[i].Key, pairs[j].Key
+		if ki.Inspect() != kj.Inspect() {
+			return ki.Inspect() < kj.Inspect()
+		}
+		return ki.Type() < kj.Type()
+	})
+	return pairs
+}
+
+// deepCopy 递归复制数组和哈希，其余的值不可变（函数也不会被修改），直接共用
+func deepCopy(obj object.Object) object.Object {
+	switch obj := obj.(type) {
+	case *object.Array:
+		elements := make([]object.Object, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = deepCopy(el)
+		}
+		return &object.Array{Elements: elements}
+	case *object.Hash:
+		pairs := make(map[object.HashKey]object.HashPair, len(obj.Pairs))
+		for k, pair := range obj.Pairs {
+			// 键只能是整数、字符串、布尔值，不需要复制
+			pairs[k] = object.HashPair{Key: pair.Key, Value: deepCopy(pair.Value)}
+		}
+		return &object.Hash{Pairs: pairs}
+	default:
+		return obj
+	}
+}
+
+// jsonValue 把值转换成可以交给encoding/json的Go值
+// 哈希的键取Inspect的结果，整数1变成"1"，布尔true变成"true"；输出时键按字典序排列
+// 转换后重复的键（比如1和"1"）、函数、错误以及NaN、Inf这类JSON无法表示的值都返回错误
+func jsonValue(obj object.Object) (interface{}, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return nil, newError("to_json无法表示的小数: %s", obj.Inspect())
+		}
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Boolean:
+		return obj.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := jsonValue(el)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *object.Hash:
+		values := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key := pair.Key.Inspect()
+			if _, ok := values[key]; ok {
+				return nil, newError("to_json的键转换成字符串后重复: %s", key)
+			}
+			value, err := jsonValue(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	default:
+		return nil, newError("to_json不支持的参数类型，%s", obj.Type())
+	}
+}
+
+// fromJSONValue 把解码后的JSON转换成Monkey的值
+// 没有小数点和指数的数字转成整数，超出int64范围时返回错误而不是悄悄丢失精度；其余数字转成小数
+func fromJSONValue(value interface{}) object.Object {
+	switch value := value.(type) {
+	case nil:
+		return NULL
+	case bool:
+		return nativeBoolToBooleanObject(value)
+	case string:
+		return &object.String{Value: value}
+	case json.Number:
+		if !strings.ContainsAny(value.String(), ".eE") {
+			integer, err := value.Int64()
+			if err != nil {
+				return newError("from_json整数超出范围: %s", value)
+			}
+			return newInteger(integer)
+		}
+		float, err := value.Float64()
+		if err != nil {
+			return newError("from_json小数超出范围: %s", value)
+		}
+		return &object.Float{Value: float}
+	case []interface{}:
+		elements := make([]object.Object, len(value))
+		for i, el := range value {
+			elements[i] = fromJSONValue(el)
+			if isError(elements[i]) {
+				return elements[i]
+			}
+		}
+		return &object.Array{Elements: elements}
+	case map[string]interface{}:
+		pairs := make(map[object.HashKey]object.HashPair, len(value))
+		for k, v := range value {
+			key := &object.String{Value: k}
+			val := fromJSONValue(v)
+			if isError(val) {
+				return val
+			}
+			pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+		}
+		return &object.Hash{Pairs: pairs}
+	default:
+		return newError("from_json不支持的类型，%T", value)
+	}
+}
+
+// commafy 从低位开始每三位插入一个分隔符，负号保留在最前面
+func commafy(n int64, sep string) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if digits[0] == '-' {
+		sign = "-"
+		digits = digits[1:]
+	}
+	var out []byte
+	for i := 0; i < len(digits); i++ {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, sep...)
+		}
+		out = append(out, digits[i])
+	}
+	return sign + string(out)
+}
+
+// RegisterBuiltin 给这个Evaluator注册宿主程序提供的内置函数，脚本里可以像len一样直接调用
+// 名字与已有的内置函数冲突时返回错误，不会覆盖；脚本里let定义的同名变量仍然优先
+func (e *Evaluator) RegisterBuiltin(name string, fn object.BuiltinFunction) error {
+	if fn == nil {
+		return fmt.Errorf("内置函数不能为nil: %s", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return fmt.Errorf("内置函数已存在: %s", name)
+	}
+	if _, ok := evaluatorBuiltins[name]; ok {
+		return fmt.Errorf("内置函数已存在: %s", name)
+	}
+	if _, ok := e.builtins[name]; ok {
+		return fmt.Errorf("内置函数已存在: %s", name)
+	}
+	e.builtins[name] = &object.Builtin{Fn: fn}
+	return nil
+}
+
+// format {}按顺序替换为参数的Inspect，{{和}}分别转义为{和}，其余的单个大括号原样保留
+func format(template string, args []object.Object) object.Object {
+	var out strings.Builder
+	used := 0
+	for i := 0; i < len(template); i++ {
+		ch := template[i]
+		if i+1 < len(template) {
+			next := template[i+1]
+			switch {
+			case ch == '{' && next == '{', ch == '}' && next == '}':
+				out.WriteByte(ch)
+				i++
+				continue
+			case ch == '{' && next == '}':
+				if used >= len(args) {
+					return newError("format参数不足，占位符多于%d个参数", len(args))
+				}
+				out.WriteString(args[used].Inspect())
+				used++
+				i++
+				continue
+			}
+		}
+		out.WriteByte(ch)
+	}
+	if used < len(args) {
+		return newError("format参数过多，需要%d个，实际%d个", used, len(args))
+	}
+	return &object.String{Value: out.String()}
+}
+
+// powInt 快速幂，结果超出int64范围时返回false
+func powInt(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			var ok bool
+			if result, ok = mulInt(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			var ok bool
+			if base, ok = mulInt(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// mulInt 整数乘法，溢出时返回false
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return c, true
+}
+
+// roundFloat floor、ceil、round的实现，小数取整后转成整数，整数原样返回
+func roundFloat(name string, args []object.Object, fn func(float64) float64) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg
+	case *object.Float:
+		value := fn(arg.Value)
+		// 2^63 无法用int64表示，NaN与任何数比较都是false
+		if !(value >= math.MinInt64 && value < math.MaxInt64) {
+			return newError("%s结果超出整数范围: %s", name, arg.Inspect())
+		}
+		return newInteger(int64(value))
+	default:
+		return newError("%s不支持的参数类型，%s", name, args[0].Type())
+	}
+}
+
+// mapString 只接受一个字符串参数、返回转换后字符串的内置函数
+func mapString(name string, args []object.Object, fn func(string) string) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("%s不支持的参数类型，%s", name, args[0].Type())
+	}
+	return &object.String{Value: fn(str.Value)}
+}
+
+// typePredicate is_null、is_array这类判断类型的内置函数，参数的类型是types之一时返回true
+// 参数出错时在调用之前就已经中断了评估，所以is_error只有一个参数时由evalIsError处理
+func typePredicate(types ...object.Type) *object.Builtin {
+	return &object.Builtin{
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("入参数量不正确，需要1个，实际%d个", len(args))
+			}
+			for _, t := range types {
+				if args[0].Type() == t {
+					return TRUE
+				}
+			}
+			return FALSE
+		},
+	}
+}
+
+// matchString starts_with、ends_with的实现，两个参数都必须是字符串
+func matchString(name string, args []object.Object, fn func(s, affix string) bool) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return newError("%s不支持的参数类型，%s", name, args[0].Type())
+	}
+	affix, ok := args[1].(*object.String)
+	if !ok {
+		return newError("%s不支持的参数类型，%s", name, args[1].Type())
+	}
+	return nativeBoolToBooleanObject(fn(str.Value, affix.Value))
+}
+
+// extremum min、max的实现，既可以传多个数 max(3, 7, 2)，也可以只传一个数组 max([3, 7, 2])
+// better(a, b)为true时a比b更符合要求
+func extremum(name string, args []object.Object, better func(a, b object.Object) bool) object.Object {
+	if len(args) == 0 {
+		return newError("入参数量不正确，至少需要1个，实际0个")
+	}
+	if len(args) == 1 {
+		if arr, ok := args[0].(*object.Array); ok {
+			if len(arr.Elements) == 0 {
+				return newError("%s的数组不能为空", name)
+			}
+			args = arr.Elements
+		}
+	}
+	var result object.Object
+	hasFloat := false
+	for _, arg := range args {
+		if !isNumber(arg) {
+			return newError("%s不支持的参数类型，%s", name, arg.Type())
+		}
+		if arg.Type() == object.FLOAT_OBJ {
+			hasFloat = true
+		}
+		if result == nil || better(arg, result) {
+			result = arg
+		}
+	}
+	// 整数和小数混在一起时结果统一是小数
+	if hasFloat {
+		return &object.Float{Value: toFloat(result)}
+	}
+	return result
+}
+
+// numberLess 比较两个数，都是整数时按整数比较，避免大整数转换成float64后丢失精度
+func numberLess(a, b object.Object) bool {
+	if x, ok := a.(*object.Integer); ok {
+		if y, ok := b.(*object.Integer); ok {
+			return x.Value < y.Value
+		}
+	}
+	return toFloat(a) < toFloat(b)
+}
+
+// evaluatorBuiltin 需要调用函数或者用到评估状态的内置函数，调用时传入正在评估的Evaluator
+// 不能在创建时绑定Evaluator：内置函数的值会随环境被其他Evaluator使用，这时要用调用它的那个Evaluator的context和调用层数
+type evaluatorBuiltin struct {
+	fn func(e *Evaluator, args ...object.Object) object.Object
+}
+
+func (b *evaluatorBuiltin) Type() object.Type {
+	return object.BUILTIN_OBJ
+}
+
+func (b *evaluatorBuiltin) Inspect() string {
+	return "内置函数"
+}
+
+// evaluatorBuiltins 需要调用函数或者用到评估状态的内置函数
+var evaluatorBuiltins map[string]*evaluatorBuiltin
+
+func init() {
+	// 这些内置函数需要调用applyFunction，写在字面量里会造成初始化循环，所以在这里赋值
+	evaluatorBuiltins = map[string]*evaluatorBuiltin{
+		"map":        {fn: (*Evaluator).builtinMap},
+		"filter":     {fn: (*Evaluator).builtinFilter},
+		"chunk_by":   {fn: (*Evaluator).builtinChunkBy},
+		"group_by":   {fn: (*Evaluator).builtinGroupBy},
+		"reduce":     {fn: (*Evaluator).builtinReduce},
+		"sort":       {fn: (*Evaluator).builtinSort},
+		"apply":      {fn: (*Evaluator).builtinApply},
+		"partial":    {fn: (*Evaluator).builtinPartial},
+		"compose":    {fn: (*Evaluator).builtinCompose},
+		"memoize":    {fn: (*Evaluator).builtinMemoize},
+		"import":     {fn: (*Evaluator).builtinImport},
+		"sleep":      {fn: (*Evaluator).builtinSleep},
+		"read_file":  {fn: (*Evaluator).builtinReadFile},
+		"write_file": {fn: (*Evaluator).builtinWriteFile},
+		"puts":       {fn: (*Evaluator).builtinPuts},
+		"print":      {fn: (*Evaluator).builtinPrint},
+		"random":     {fn: (*Evaluator).builtinRandom},
+		"seed":       {fn: (*Evaluator).builtinSeed},
+		"now":        {fn: (*Evaluator).builtinNow},
+	}
+}
+
+func (e *Evaluator) builtinReadFile(args ...object.Object) object.Object {
+	if !e.EnableFileIO {
+		return newError("文件读写未开启")
+	}
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("read_file不支持的参数类型，%s", args[0].Type())
+	}
+	content, err := os.ReadFile(path.Value)
+	if err != nil {
+		return newError("读取文件失败: %s", err)
+	}
+	return &object.String{Value: string(content)}
+}
+
+func (e *Evaluator) builtinWriteFile(args ...object.Object) object.Object {
+	if !e.EnableFileIO {
+		return newError("文件读写未开启")
+	}
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	path, ok := args[0].(*object.String)
+	if !ok {
+		return newError("write_file不支持的参数类型，%s", args[0].Type())
+	}
+	content, ok := args[1].(*object.String)
+	if !ok {
+		return newError("write_file不支持的参数类型，%s", args[1].Type())
+	}
+	if err := os.WriteFile(path.Value, []byte(content.Value), 0644); err != nil {
+		return newError("写入文件失败: %s", err)
+	}
+	return newInteger(int64(len(content.Value)))
+}
+
+func (e *Evaluator) builtinPuts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		_, _ = fmt.Fprintln(e.Output, arg.Inspect())
+	}
+	return NULL
+}
+
+func (e *Evaluator) builtinPrint(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	// 不换行，并把参数原样返回，方便插在表达式中间调试
+	_, _ = fmt.Fprint(e.Output, args[0].Inspect())
+	return args[0]
+}
+
+func (e *Evaluator) builtinRandom(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("入参数量不正确，需要1到2个，实际%d个", len(args))
+	}
+	bounds := make([]int64, len(args))
+	for i, arg := range args {
+		num, ok := arg.(*object.Integer)
+		if !ok {
+			return newError("random不支持的参数类型，%s", arg.Type())
+		}
+		bounds[i] = num.Value
+	}
+	// random(n) 是 [0, n)，random(a, b) 是 [a, b)
+	low, high := int64(0), bounds[0]
+	if len(bounds) == 2 {
+		low, high = bounds[0], bounds[1]
+	}
+	if high <= low {
+		return newError("random的范围为空: [%d, %d)", low, high)
+	}
+	span := high - low
+	if span <= 0 {
+		return newError("random的范围过大: [%d, %d)", low, high)
+	}
+	return newInteger(low + e.randomSource().Int63n(span))
+}
+
+func (e *Evaluator) builtinSeed(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	num, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("seed不支持的参数类型，%s", args[0].Type())
+	}
+	e.Rand = rand.New(rand.NewSource(num.Value))
+	return NULL
+}
+
+func (e *Evaluator) builtinNow(args ...object.Object) object.Object {
+	// now() 返回秒级的Unix时间戳，now("ms") 返回毫秒
+	if len(args) > 1 {
+		return newError("入参数量不正确，需要0到1个，实际%d个", len(args))
+	}
+	unit := "s"
+	if len(args) == 1 {
+		str, ok := args[0].(*object.String)
+		if !ok {
+			return newError("now不支持的参数类型，%s", args[0].Type())
+		}
+		unit = str.Value
+	}
+	switch unit {
+	case "s":
+		return newInteger(e.Now().Unix())
+	case "ms":
+		return newInteger(e.Now().UnixMilli())
+	default:
+		return newError("now不支持的时间单位: %s", unit)
+	}
+}
+
+// randomSource random使用的随机数生成器，没有设置Rand时按当前时间播种
+func (e *Evaluator) randomSource() *rand.Rand {
+	if e.Rand == nil {
+		e.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return e.Rand
+}
+
+// builtinSleep 用EvalContext评估时，context被取消或超时后立即返回，不用等到时间结束
+func (e *Evaluator) builtinSleep(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("sleep不支持的参数类型，%s", args[0].Type())
+	}
+	if ms.Value < 0 {
+		return newError("sleep的时间不能为负数: %d", ms.Value)
+	}
+	if ms.Value > int64(math.MaxInt64/time.Millisecond) {
+		return newError("sleep的时间过长: %d", ms.Value)
+	}
+	timer := time.NewTimer(time.Duration(ms.Value) * time.Millisecond)
+	defer timer.Stop()
+	if e.ctx == nil {
+		<-timer.C
+		return NULL
+	}
+	select {
+	case <-timer.C:
+		return NULL
+	case <-e.ctx.Done():
+		return e.checkContext()
+	}
+}
+
+func (e *Evaluator) builtinMap(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("map不支持的参数类型，%s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("map不支持的参数类型，%s", args[1].Type())
+	}
+	newElements := make([]object.Object, len(arr.Elements))
+	for i, el := range arr.Elements {
+		result := e.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		newElements[i] = result
+	}
+	return &object.Array{Elements: newElements}
+}
+
+func (e *Evaluator) builtinFilter(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("filter不支持的参数类型，%s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("filter不支持的参数类型，%s", args[1].Type())
+	}
+	newElements := make([]object.Object, 0)
+	for _, el := range arr.Elements {
+		result := e.applyFunction(args[1], []object.Object{el})
+		if isError(result) {
+			return result
+		}
+		// 与if的判断保持一致，非布尔的值也按真值处理
+		if isTruthy(result) {
+			newElements = append(newElements, el)
+		}
+	}
+	return &object.Array{Elements: newElements}
+}
+
+func (e *Evaluator) builtinChunkBy(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("chunk_by不支持的参数类型，%s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("chunk_by不支持的参数类型，%s", args[1].Type())
+	}
+	chunks := make([]object.Object, 0)
+	var current []object.Object
+	var prevKey object.Object
+	for _, el := range arr.Elements {
+		key := e.applyFunction(args[1], []object.Object{el})
+		if isError(key) {
+			return key
+		}
+		if current != nil && !sameKey(prevKey, key) {
+			// 投影的值变了，开始新的一组
+			chunks = append(chunks, &object.Array{Elements: current})
+			current = nil
+		}
+		current = append(current, el)
+		prevKey = key
+	}
+	if current != nil {
+		chunks = append(chunks, &object.Array{Elements: current})
+	}
+	return &object.Array{Elements: chunks}
+}
+
+// builtinGroupBy group_by(arr, fn) 按fn(元素)的结果分组，返回 键 -> 元素数组 的哈希，组内保持原来的顺序
+// 与chunk_by不同，键相同的元素不管是否相邻都分到同一组
+func (e *Evaluator) builtinGroupBy(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("group_by不支持的参数类型，%s", args[0].Type())
+	}
+	if !isCallable(args[1]) {
+		return newError("group_by不支持的参数类型，%s", args[1].Type())
+	}
+	groups := make(map[object.HashKey]object.HashPair)
+	for _, el := range arr.Elements {
+		key := e.applyFunction(args[1], []object.Object{el})
+		if isError(key) {
+			return key
+		}
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return newError("无法作为哈希的键, %s", key.Type())
+		}
+		hashKey := hashable.HashKey()
+		group, ok := groups[hashKey]
+		if !ok {
+			group = object.HashPair{Key: key, Value: &object.Array{}}
+		}
+		bucket := group.Value.(*object.Array)
+		bucket.Elements = append(bucket.Elements, el)
+		groups[hashKey] = group
+	}
+	return &object.Hash{Pairs: groups}
+}
+
+func (e *Evaluator) builtinReduce(args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError("入参数量不正确，需要3个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("reduce不支持的参数类型，%s", args[0].Type())
+	}
+	if !isCallable(args[2]) {
+		return newError("reduce不支持的参数类型，%s", args[2].Type())
+	}
+	acc := args[1]
+	for _, el := range arr.Elements {
+		acc = e.applyFunction(args[2], []object.Object{acc, el})
+		if isError(acc) {
+			return acc
+		}
+	}
+	return acc
+}
+
+// builtinSort 返回排序后的新数组，不修改原数组
+// 不传比较函数时只支持全是整数或全是字符串的数组；比较函数cmp(a, b)返回负数、0、正数分别表示a小于、等于、大于b
+func (e *Evaluator) builtinSort(args ...object.Object) object.Object {
+	if len(args) != 1 && len(args) != 2 {
+		return newError("入参数量不正确，需要1到2个，实际%d个", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("sort不支持的参数类型，%s", args[0].Type())
+	}
+	sorted := make([]object.Object, len(arr.Elements))
+	copy(sorted, arr.Elements)
+	if len(args) == 2 {
+		if !isCallable(args[1]) {
+			return newError("sort不支持的参数类型，%s", args[1].Type())
+		}
+		var errObj object.Object
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if errObj != nil {
+				return false
+			}
+			result := e.applyFunction(args[1], []object.Object{sorted[i], sorted[j]})
+			if isError(result) {
+				errObj = result
+				return false
+			}
+			cmp, ok := result.(*object.Integer)
+			if !ok {
+				errObj = newError("sort的比较函数必须返回整数，实际返回%s", result.Type())
+				return false
+			}
+			return cmp.Value < 0
+		})
+		if errObj != nil {
+			return errObj
+		}
+		return &object.Array{Elements: sorted}
+	}
+	for _, el := range sorted {
+		if el.Type() != object.INTEGER_OBJ && el.Type() != object.STRING_OBJ {
+			return newError("sort不支持的元素类型，%s", el.Type())
+		}
+		if el.Type() != sorted[0].Type() {
+			return newError("sort的数组元素类型不一致: %s 与 %s", sorted[0].Type(), el.Type())
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		switch left := sorted[i].(type) {
+		case *object.Integer:
+			return left.Value < sorted[j].(*object.Integer).Value
+		default:
+			return left.(*object.String).Value < sorted[j].(*object.String).Value
+		}
+	})
+	return &object.Array{Elements: sorted}
+}
+
+// builtinApply apply(fn, args) 把数组元素展开作为参数调用fn
+func (e *Evaluator) builtinApply(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("入参数量不正确，需要2个，实际%d个", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("apply不支持的参数类型，%s", args[0].Type())
+	}
+	arr, ok := args[1].(*object.Array)
+	if !ok {
+		return newError("apply不支持的参数类型，%s", args[1].Type())
+	}
+	// 复制一份，避免可变参数收集到的数组与传入的数组共用底层存储
+	callArgs := make([]object.Object, len(arr.Elements))
+	copy(callArgs, arr.Elements)
+	return e.applyFunction(args[0], callArgs)
+}
+
+// builtinPartial partial(fn, a, ...) 返回一个新函数，调用时把预先绑定的参数放在前面再调用fn
+func (e *Evaluator) builtinPartial(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("入参数量不正确，至少需要1个，实际0个")
+	}
+	fn := args[0]
+	if !isCallable(fn) {
+		return newError("partial不支持的参数类型，%s", fn.Type())
+	}
+	bound := make([]object.Object, len(args)-1)
+	copy(bound, args[1:])
+	return &evaluatorBuiltin{fn: func(caller *Evaluator, rest ...object.Object) object.Object {
+		callArgs := make([]object.Object, 0, len(bound)+len(rest))
+		callArgs = append(callArgs, bound...)
+		callArgs = append(callArgs, rest...)
+		return caller.applyFunction(fn, callArgs)
+	}}
+}
+
+// builtinCompose compose(f, g, ...) 返回从右到左依次调用的函数，compose(f, g)(x) 等价于 f(g(x))
+// 最右边的函数接收调用时的全部参数，其余的函数接收上一个函数的返回值
+func (e *Evaluator) builtinCompose(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("入参数量不正确，至少需要1个，实际0个")
+	}
+	for _, fn := range args {
+		if !isCallable(fn) {
+			return newError("compose不支持的参数类型，%s", fn.Type())
+		}
+	}
+	fns := make([]object.Object, len(args))
+	copy(fns, args)
+	return &evaluatorBuiltin{fn: func(caller *Evaluator, callArgs ...object.Object) object.Object {
+		result := caller.applyFunction(fns[len(fns)-1], callArgs)
+		for i := len(fns) - 2; i >= 0; i-- {
+			if isError(result) {
+				return result
+			}
+			result = caller.applyFunction(fns[i], []object.Object{result})
+		}
+		return result
+	}}
+}
+
+// builtinMemoize memoize(fn) 返回带缓存的函数，参数相同时直接返回上次的结果，出错的结果不缓存
+// 每次调用memoize都有独立的缓存
+func (e *Evaluator) builtinMemoize(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	fn := args[0]
+	if !isCallable(fn) {
+		return newError("memoize不支持的参数类型，%s", fn.Type())
+	}
+	cache := make(map[string]object.Object)
+	return &evaluatorBuiltin{fn: func(caller *Evaluator, callArgs ...object.Object) object.Object {
+		key := memoizeKey(callArgs)
+		if result, ok := cache[key]; ok {
+			return result
+		}
+		result := caller.applyFunction(fn, callArgs)
+		if !isError(result) {
+			cache[key] = result
+		}
+		return result
+	}}
+}
+
+// memoizeKey 把参数按结构编码成缓存的键，每个值都带上类型，字符串加引号，数组和哈希递归编码
+// 函数这类没有值可比较的参数按对象本身区分
+func memoizeKey(args []object.Object) string {
+	var out bytes.Buffer
+	for i, arg := range args {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		writeMemoizeKey(&out, arg)
+	}
+	return out.String()
+}
+
+func writeMemoizeKey(out *bytes.Buffer, obj object.Object) {
+	switch obj := obj.(type) {
+	case object.Hashable:
+		key := obj.HashKey()
+		fmt.Fprintf(out, "%s:%d:%q", key.Type, key.Value, key.Text)
+	case *object.Float:
+		fmt.Fprintf(out, "%s:%s", obj.Type(), strconv.FormatFloat(obj.Value, 'g', -1, 64))
+	case *object.Null:
+		out.WriteString(string(obj.Type()))
+	case *object.Array:
+		out.WriteString("[")
+		for i, el := range obj.Elements {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			writeMemoizeKey(out, el)
+		}
+		out.WriteString("]")
+	case *object.Hash:
+		out.WriteString("{")
+		for i, pair := range sortedPairs(obj) {
+			if i > 0 {
+				out.WriteString(",")
+			}
+			writeMemoizeKey(out, pair.Key)
+			out.WriteString(":")
+			writeMemoizeKey(out, pair.Value)
+		}
+		out.WriteString("}")
+	default:
+		fmt.Fprintf(out, "%s:%p", obj.Type(), obj)
+	}
+}
+
+// builtinImport import("path") 解析并评估另一个脚本文件，把它顶层定义的变量作为哈希返回
+// 相对路径相对于正在导入的模块所在目录，顶层脚本里则相对于当前工作目录
+// 与read_file一样需要开启EnableFileIO
+func (e *Evaluator) builtinImport(args ...object.Object) object.Object {
+	if !e.EnableFileIO {
+		return newError("文件读写未开启")
+	}
+	if len(args) != 1 {
+		return newError("入参数量不正确，需要1个，实际%d个", len(args))
+	}
+	pathStr, ok := args[0].(*object.String)
+	if !ok {
+		return newError("import不支持的参数类型，%s", args[0].Type())
+	}
+	path := pathStr.Value
+	if !filepath.IsAbs(path) && len(e.importing) > 0 {
+		path = filepath.Join(filepath.Dir(e.importing[len(e.importing)-1]), path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return newError("导入模块失败: %s", err)
+	}
+	for i, p := range e.importing {
+		if p == path {
+			cycle := append(append([]string{}, e.importing[i:]...), path)
+			return newError("循环导入: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return newError("导入模块失败: %s", err)
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		// 语法错误里带有文件中的内容，只报告数量，避免通过import读出任意文件
+		return newError("导入模块 %s 解析失败: %d个语法错误", path, len(p.Errors()))
+	}
+
+	e.importing = append(e.importing, path)
+	defer func() { e.importing = e.importing[:len(e.importing)-1] }()
+
+	result, bindings := e.EvalAndCollect(program, object.NewEnvironment())
+	if isError(result) {
+		return result
+	}
+	pairs := make(map[object.HashKey]object.HashPair, len(bindings))
+	for name, value := range bindings {
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+// clampIndex 与Python的切片一致，负数从末尾倒数，超出范围的下标收缩到[0, length]
+func clampIndex(index int64, length int) int {
+	if index < 0 {
+		index += int64(length)
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > int64(length) {
+		return length
+	}
+	return int(index)
+}
+
+// sameKey 整数、小数、字符串、布尔、null与==一致按值比较，1和1.0相等；数组、哈希、函数按指针比较
+func sameKey(a, b object.Object) bool {
+	if isScalar(a) && isScalar(b) {
+		return objectsEqual(a, b)
+	}
+	return a == b
+}
+
+func isScalar(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Integer, *object.Float, *object.String, *object.Boolean, *object.Null:
+		return true
+	default:
+		return false
+	}
+}
+
+// uniqueKey unique去重用的键，与sameKey的判断一致：
+// 整数和没有小数部分的小数用整数的哈希键，其余的小数用数值本身，字符串、布尔用哈希键，其余的用对象本身
+func uniqueKey(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Float:
+		// -2^63 <= v < 2^63 时才能转换成int64
+		if v := obj.Value; v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return (&object.Integer{Value: int64(v)}).HashKey()
+		}
+		return obj.Value
+	case object.Hashable:
+		return obj.HashKey()
+	default:
+		return obj
+	}
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin, *evaluatorBuiltin:
+		return true
+	default:
+		return false
+	}
 }
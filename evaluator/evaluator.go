@@ -1,9 +1,17 @@
 package evaluator
 
 import (
+	"context"
 	"fmt"
 	"interpreter/ast"
 	"interpreter/object"
+	"interpreter/token"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
 )
 
 var (
@@ -13,101 +21,282 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+const (
+	// 缓存的小整数范围，和TRUE、FALSE一样复用同一个对象，减少运算时的内存分配
+	minCachedInteger = -128
+	maxCachedInteger = 256
+)
+
+var cachedIntegers = func() []*object.Integer {
+	integers := make([]*object.Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range integers {
+		integers[i] = &object.Integer{Value: int64(i + minCachedInteger)}
+	}
+	return integers
+}()
+
+// newInteger 小整数直接取缓存，其余的才分配新对象，整数对象不可变所以可以共享
+func newInteger(value int64) *object.Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return cachedIntegers[value-minCachedInteger]
+	}
+	return &object.Integer{Value: value}
+}
+
+const (
+	// defaultMaxCallDepth New创建的Evaluator默认的最大调用层数
+	defaultMaxCallDepth = 1000
+	// defaultMaxTailCalls New创建的Evaluator默认一次调用里最多连续执行的尾调用次数
+	defaultMaxTailCalls = 1000000
+)
+
+// Evaluator 保存一次评估用到的状态，不同的Evaluator互不影响，可以在多个goroutine里同时使用
+// 同一个Evaluator同一时间只能执行一个评估
+type Evaluator struct {
+	// MaxCallDepth 函数调用的最大嵌套层数，超过后返回错误而不是让Go栈溢出，为0时不限制
+	MaxCallDepth int
+	// MaxTailCalls 一次函数调用里最多连续执行的尾调用次数，尾递归不占用调用栈，
+	// 靠它让无限的尾递归也能结束，为0时不限制
+	MaxTailCalls int
+	// Output 内置函数puts、print的输出位置，默认是标准输出，嵌入使用或测试时可以替换
+	Output io.Writer
+	// Rand random使用的随机数生成器，为nil时按当前时间播种，测试时可以替换成固定种子的生成器，脚本里也可以用seed(n)重新播种
+	Rand *rand.Rand
+	// Now now()取当前时间用的时钟，测试时可以替换成返回固定时间的函数
+	Now func() time.Time
+	// EnableFileIO 是否允许read_file、write_file访问文件，默认关闭，执行不可信的脚本时不要开启
+	EnableFileIO bool
+	// Trace 设置后评估每个节点时都会通知它，为nil时不跟踪
+	Trace Tracer
+	// depth 当前函数调用的嵌套层数
+	depth int
+	// importing 正在导入中的模块路径，按导入顺序排列，用于解析相对路径和发现循环导入
+	importing []string
+	// ctx 当前评估使用的context，为nil时不检查取消
+	ctx context.Context
+	// builtins 用RegisterBuiltin注册到这个Evaluator上的内置函数
+	builtins map[string]*object.Builtin
+}
+
+// New 创建一个新的Evaluator
+func New() *Evaluator {
+	return &Evaluator{
+		MaxCallDepth: defaultMaxCallDepth,
+		MaxTailCalls: defaultMaxTailCalls,
+		Output:       os.Stdout,
+		Now:          time.Now,
+		builtins:     make(map[string]*object.Builtin),
+	}
+}
+
+// Eval 用新的Evaluator评估node
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+// EvalContext 用新的Evaluator评估node，见Evaluator.EvalContext
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return New().EvalContext(ctx, node, env)
+}
+
+// EvalAndCollect 用新的Evaluator评估程序，见Evaluator.EvalAndCollect
+func EvalAndCollect(program *ast.Program, env *object.Environment) (object.Object, map[string]object.Object) {
+	return New().EvalAndCollect(program, env)
+}
+
+// EvalContext 与Eval相同，但会在函数调用和循环时检查ctx，ctx被取消或超时后返回错误对象
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	prev := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = prev }()
+	return e.Eval(node, env)
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	// 不跟踪时只多一次判断
+	if e.Trace == nil {
+		return e.eval(node, env)
+	}
+	e.Trace.Enter(node)
+	result := e.eval(node, env)
+	e.Trace.Exit(node, result)
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program: // 程序评估入口
-		return evalProgram(node.Statements, env)
+		return e.evalProgram(node.Statements, env)
 	case *ast.ExpressionStatement: // 表达式语句
-		return Eval(node.Expression, env)
+		return e.Eval(node.Expression, env)
 	case *ast.LetStatement: // 变量绑定表达式
-		val := Eval(node.Value, env)
+		if env.IsLocalConst(node.Name.Value) {
+			return withPosition(newError("无法重新赋值常量: %s", node.Name.Value), node.Name.Token)
+		}
+		val := e.Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
+	case *ast.ConstStatement: // 常量绑定
+		if env.IsLocalConst(node.Name.Value) {
+			return withPosition(newError("无法重新赋值常量: %s", node.Name.Value), node.Name.Token)
+		}
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		env.SetConst(node.Name.Value, val)
 	case *ast.PrefixExpression: // 前缀表达式
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return withPosition(evalPrefixExpression(node.Operator, right), node.Token)
 	case *ast.InfixExpression: // 中缀表达式
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		right := Eval(node.Right, env)
+		right := e.Eval(node.Right, env)
 		if isError(right) {
 			return right
 		}
-		return evalInfixExpression(node.Operator, left, right)
+		return withPosition(evalInfixExpression(node.Operator, left, right), node.Token)
+	case *ast.ComparisonChain: // 连续比较
+		return e.evalComparisonChain(node, env)
 	case *ast.BlockStatement: // 大括号内表达式
-		return evalBlockStatement(node, env)
+		return e.evalBlockStatement(node, env)
 	case *ast.IfExpression: // if表达式
-		return evalIfExpression(node, env)
+		return e.evalIfExpression(node, env)
+	case *ast.TernaryExpression: // 三元表达式
+		return e.evalTernaryExpression(node, env)
+	case *ast.WhileExpression: // while循环
+		return e.evalWhileExpression(node, env)
+	case *ast.ForInStatement: // for-in循环
+		return e.evalForInStatement(node, env)
+	case *ast.AssignExpression: // 赋值表达式
+		if env.IsConst(node.Name.Value) {
+			return withPosition(newError("无法重新赋值常量: %s", node.Name.Value), node.Name.Token)
+		}
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if _, ok := env.Assign(node.Name.Value, val); !ok {
+			return withPosition(newError("变量未定义: %s", node.Name.Value), node.Name.Token)
+		}
+		return val
+	case *ast.PostfixExpression: // i++ i--
+		return withPosition(evalPostfixExpression(node, env), node.Token)
+	case *ast.DeferStatement: // defer语句，只登记不执行
+		env.Defer(node.Expression)
 	case *ast.ReturnStatement: // return表达式
-		val := Eval(node.ReturnValue, env)
+		if node.ReturnValue == nil {
+			// 没有返回值的return返回null
+			return &object.ReturnValue{Value: NULL}
+		}
+		val := e.Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.IntegerLiteral: // 纯数字
-		return &object.Integer{Value: node.Value}
+		return newInteger(node.Value)
+	case *ast.FloatLiteral: // 小数
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral: // 字符串
 		return &object.String{Value: node.Value}
 	case *ast.Boolean: // 纯布尔
 		return nativeBoolToBooleanObject(node.Value)
+	case *ast.Null: // null，复用同一个NULL
+		return NULL
 	case *ast.Identifier: // 变量
-		return evalIdentifier(node, env)
+		return withPosition(e.evalIdentifier(node, env), node.Token)
 	case *ast.ArrayLiteral: // 数组
-		elements := evalExpressions(node.Elements, env)
+		elements := e.evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression: // 访问数组、哈希
-		left := Eval(node.Left, env)
+		left := e.Eval(node.Left, env)
 		if isError(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
+		index := e.Eval(node.Index, env)
 		if isError(index) {
 			return index
 		}
-		return evalIndexExpression(left, index)
+		return withPosition(evalIndexExpression(left, index), node.Token)
+	case *ast.MemberExpression: // h.key 访问哈希的字符串键
+		receiver := e.Eval(node.Object, env)
+		if isError(receiver) {
+			return receiver
+		}
+		return withPosition(evalMemberExpression(receiver, node.Property.Value), node.Token)
 	case *ast.HashLiteral: // 哈希
-		return evalHashLiteral(node, env)
+		return e.evalHashLiteral(node, env)
 	case *ast.FunctionLiteral: // 函数定义
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Body: body, Env: env}
 	case *ast.CallExpression: // 函数调用
 		// 可能是函数名(IDENT)，也可能是函数定义(FUNCTION_LITERAL)
-		function := Eval(node.Function, env)
+		function := e.Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
+		if function == isErrorBuiltin && len(node.Arguments) == 1 {
+			return e.evalIsError(node.Arguments[0], env)
+		}
 		// 参数值
-		args := evalExpressions(node.Arguments, env)
+		args := e.evalExpressions(node.Arguments, env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(function, args)
+		return withPosition(e.applyFunction(function, args), node.Token)
 	}
 	return nil
 }
 
-func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
+// EvalAndCollect 评估程序，同时返回本次评估在顶层环境中新定义的所有变量
+func (e *Evaluator) EvalAndCollect(program *ast.Program, env *object.Environment) (object.Object, map[string]object.Object) {
+	existing := make(map[string]bool)
+	for _, name := range env.Keys(false) {
+		existing[name] = true
+	}
+	result := e.Eval(program, env)
+	bindings := make(map[string]object.Object)
+	for _, name := range env.Keys(false) {
+		if existing[name] {
+			continue
+		}
+		bindings[name], _ = env.Get(name)
+	}
+	return result, bindings
+}
+
+func (e *Evaluator) evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
+	result := e.evalProgramStatements(stmts, env)
+	// 顶层的defer在程序结束时执行
+	if deferredErr := e.runDeferred(env); deferredErr != nil && !isError(result) {
+		return deferredErr
+	}
+	return result
+}
+
+func (e *Evaluator) evalProgramStatements(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range stmts {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 		// 大括号内表达式如果复用这个方法，那嵌套块的情况下，内层块return了，递归回上层就只是个普通object，那就还会继续评估后面的内容
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			// 表达式中遇到了return就直接返回，不再评估后面的内容
 			return result.Value
-		case *object.Error:
-			// 错误也需直接返回
+		case *object.Error, *object.Exit:
+			// 错误和exit也需直接返回
 			return result
 		}
 	}
@@ -115,22 +304,31 @@ func evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	return result
 }
 
-func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+// evalBlockStatement 块的值是最后一条语句的值，if、函数体、循环体都遵循这个规则
+// 空块或者最后一条是let这类没有值的语句时，块的值是NULL
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, stmt := range block.Statements {
-		result = Eval(stmt, env)
+		result = e.Eval(stmt, env)
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
 				// 如果块内是return，返回给上层，上层就可以直接return了 if (true) { if (true) {return a} return b}
 				return result
 			}
 		}
 	}
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
+	// 手动构造的语法树里操作数可能评估不出值，先判断，避免下面取类型时空指针
+	if right == nil {
+		return newError("缺少操作数: %s", operator)
+	}
 	switch operator {
 	case "!":
 		// 非
@@ -138,6 +336,13 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 	case "-":
 		// 减号
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		// 按位取反
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return newError("未知的操作: ~%s", right.Type())
+		}
+		return newInteger(^integer.Value)
 	default:
 		return newError("未知的操作: %s%s", operator, right.Type())
 	}
@@ -158,11 +363,37 @@ func evalBongOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	// 只有数字才能用减号
-	if right == nil || right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return newInteger(-right.Value)
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("未知的操作: -%s", right.Type())
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+}
+
+// evalPostfixExpression 后缀的自增自减，先把新值存回变量，表达式的结果是修改前的值
+// let i = 0; let j = i++; 之后i是1，j是0
+func evalPostfixExpression(node *ast.PostfixExpression, env *object.Environment) object.Object {
+	name := node.Name.Value
+	if env.IsConst(name) {
+		return newError("无法重新赋值常量: %s", name)
+	}
+	current, ok := env.Get(name)
+	if !ok {
+		return newError("变量未定义: %s", name)
+	}
+	integer, ok := current.(*object.Integer)
+	if !ok {
+		return newError("未知的操作: %s%s", current.Type(), node.Operator)
+	}
+	delta := int64(1)
+	if node.Operator == "--" {
+		delta = -1
+	}
+	env.Assign(name, newInteger(integer.Value+delta))
+	return integer
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
@@ -170,12 +401,20 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	// 当是数字时，必须比较内部的值，不能像布尔一样直接比较指针地址，所以数字得放判断的最前面
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	// 整数和小数混合运算、比较时把整数转成小数，所以 1 == 1.0 成立
+	// 数字和字符串不会互相转换，1 == "1" 不成立，1 < "1" 报类型不匹配
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ: // 字符串拼接
 		return evalStringInfixExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+	case operator == "*" && left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ: // 字符串重复
+		return repeatString(left.(*object.String), right.(*object.Integer))
+	case operator == "*" && left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
+		return repeatString(right.(*object.String), left.(*object.Integer))
+	case operator == "==": // 数组、哈希按结构比较，其余按指针比较
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() != right.Type():
 		return newError("类型不匹配: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -183,56 +422,303 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// objectsEqual 判断两个值是否相等，数组逐个元素、哈希逐个键值递归比较
+// 数组和哈希创建后不可修改，不会出现引用自身的结构，所以递归一定会结束
+// 整数和小数按数值比较，[1] == [1.0] 成立；其余不同类型的值总是不相等
+func objectsEqual(a, b object.Object) bool {
+	if a == b {
+		return true
+	}
+	if isNumber(a) && isNumber(b) && a.Type() != b.Type() {
+		return toFloat(a) == toFloat(b)
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a := a.(type) {
+	case *object.Integer:
+		return a.Value == b.(*object.Integer).Value
+	case *object.Float:
+		return a.Value == b.(*object.Float).Value
+	case *object.String:
+		return a.Value == b.(*object.String).Value
+	case *object.Boolean:
+		return a.Value == b.(*object.Boolean).Value
+	case *object.Array:
+		bArr := b.(*object.Array)
+		if len(a.Elements) != len(bArr.Elements) {
+			return false
+		}
+		for i, el := range a.Elements {
+			if !objectsEqual(el, bArr.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		bHash := b.(*object.Hash)
+		if len(a.Pairs) != len(bHash.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := bHash.Pairs[key]
+			if !ok || !objectsEqual(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	// 相当于包装类拆包成原始类型
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return newInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return newInteger(leftVal - rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return newInteger(leftVal * rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		// 除数为0在Go里会panic，返回错误而不是让宿主程序崩溃
+		if rightVal == 0 {
+			return newError("除以零")
+		}
+		return newInteger(leftVal / rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "&":
+		return newInteger(leftVal & rightVal)
+	case "|":
+		return newInteger(leftVal | rightVal)
+	case "^":
+		return newInteger(leftVal ^ rightVal)
+	case "<<", ">>":
+		// 负数的移位次数在Go里会panic
+		if rightVal < 0 {
+			return newError("移位次数不能为负数: %d", rightVal)
+		}
+		if operator == "<<" {
+			return newInteger(leftVal << uint64(rightVal))
+		}
+		return newInteger(leftVal >> uint64(rightVal))
 	default:
 		return newError("未知的操作: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
-func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		// 与整数保持一致，不返回Inf
+		if rightVal == 0 {
+			return newError("除以零")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
 		return newError("未知的操作: %s %s %s", left.Type(), operator, right.Type())
 	}
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat 整数或小数转换为float64，调用前需要先用isNumber判断
+func toFloat(obj object.Object) float64 {
+	if i, ok := obj.(*object.Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	// 字符串按字典序比较，相等比较的是值而不是指针
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("未知的操作: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+// repeatString 字符串重复 "ab" * 3，次数为负数时返回错误
+func repeatString(str *object.String, count *object.Integer) object.Object {
+	if count.Value < 0 {
+		return newError("字符串重复次数不能为负数: %d", count.Value)
+	}
+	// 结果长度溢出时strings.Repeat会panic
+	if len(str.Value) > 0 && count.Value > int64(math.MaxInt/len(str.Value)) {
+		return newError("字符串重复结果过长")
+	}
+	return &object.String{Value: strings.Repeat(str.Value, int(count.Value))}
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := e.Eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return e.Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return e.Eval(ie.Alternative, env)
 	} else {
 		// 条件不成立，但是没有else
 		return NULL
 	}
 }
 
+// evalComparisonChain 从左到右依次比较相邻的两个运算数，遇到不成立的比较就停止，后面的运算数不再求值
+func (e *Evaluator) evalComparisonChain(cc *ast.ComparisonChain, env *object.Environment) object.Object {
+	left := e.Eval(cc.Operands[0], env)
+	if isError(left) {
+		return left
+	}
+	var result object.Object = TRUE
+	for i, operator := range cc.Operators {
+		right := e.Eval(cc.Operands[i+1], env)
+		if isError(right) {
+			return right
+		}
+		result = withPosition(evalInfixExpression(operator, left, right), cc.Token)
+		if isError(result) || !isTruthy(result) {
+			return result
+		}
+		left = right
+	}
+	return result
+}
+
+// evalTernaryExpression 与if一致按真值判断条件，只评估被选中的分支
+func (e *Evaluator) evalTernaryExpression(te *ast.TernaryExpression, env *object.Environment) object.Object {
+	condition := e.Eval(te.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+	if isTruthy(condition) {
+		return e.Eval(te.Consequence, env)
+	}
+	return e.Eval(te.Alternative, env)
+}
+
+// evalWhileExpression 循环的值是最后一次执行循环体的值，一次都没有执行时是NULL
+func (e *Evaluator) evalWhileExpression(we *ast.WhileExpression, env *object.Environment) object.Object {
+	var last object.Object = NULL
+	for {
+		condition := e.Eval(we.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return last
+		}
+		if err := e.checkContext(); err != nil {
+			return err
+		}
+		result := e.Eval(we.Body, env)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
+				// 循环体内return或出错，不只是跳出循环，而是交给上层继续返回，直到函数调用处拆包
+				return result
+			}
+			last = result
+		}
+	}
+}
+
+// evalForInStatement 数组按下标顺序遍历元素，哈希按keys()的顺序遍历键
+// 每次迭代都在新的作用域里绑定循环变量，循环体里let定义的变量不会泄露到循环外
+// 与while一致，循环的值是最后一次执行循环体的值，没有元素时是NULL
+func (e *Evaluator) evalForInStatement(fs *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := e.Eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	var items []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		// 复制一份，循环体里修改原数组不影响遍历
+		items = append(items, iterable.Elements...)
+	case *object.Hash:
+		for _, pair := range sortedPairs(iterable) {
+			items = append(items, pair.Key)
+		}
+	default:
+		return withPosition(newError("无法遍历: %s", iterable.Type()), fs.Token)
+	}
+	var last object.Object = NULL
+	for _, item := range items {
+		if err := e.checkContext(); err != nil {
+			return err
+		}
+		loopEnv := object.NewEnclosedEnvironment(env)
+		loopEnv.Set(fs.Variable.Value, item)
+		result := e.Eval(fs.Body, loopEnv)
+		// 循环体里的defer登记在本次迭代的作用域上，迭代结束时执行
+		if deferredErr := e.runDeferred(loopEnv); deferredErr != nil && !isError(result) {
+			return deferredErr
+		}
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
+				return result
+			}
+			last = result
+		}
+	}
+	return last
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL:
@@ -254,12 +740,20 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 	// 如果之前定义成了函数，这里的就是函数 let add = fn(a,b){a+b}
 	val, ok := env.Get(node.Value)
 	if ok {
 		return val
 	}
+	if builtin, ok := e.builtins[node.Value]; ok {
+		// 宿主程序注册的内置函数
+		return builtin
+	}
+	if builtin, ok := evaluatorBuiltins[node.Value]; ok {
+		// 用到评估状态的内置函数
+		return builtin
+	}
 	if builtin, ok := builtins[node.Value]; ok {
 		// 内置函数
 		return builtin
@@ -270,10 +764,10 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return val
 }
 
-func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	result := make([]object.Object, 0)
 	for _, exp := range exps {
-		evaluated := Eval(exp, env)
+		evaluated := e.Eval(exp, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -282,26 +776,235 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+func (e *Evaluator) applyFunction(fn object.Object, args []object.Object) object.Object {
+	if err := e.checkContext(); err != nil {
+		return err
+	}
 	switch fn := fn.(type) {
 	case *object.Function: // 定义的函数
-		extendEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendEnv)
-		return unwrapReturnValue(evaluated)
+		e.depth++
+		defer func() { e.depth-- }()
+		if e.MaxCallDepth > 0 && e.depth > e.MaxCallDepth {
+			return newError("调用栈过深: 超过%d层", e.MaxCallDepth)
+		}
+		// 函数体最后一步是调用自身时不在Go里递归，而是换上新的参数回到这里重新执行，
+		// 所以尾递归不会占用调用栈，不计入调用层数，而是单独受MaxTailCalls限制
+		var tail *tailCall
+		for tailCalls := 0; ; tailCalls++ {
+			if e.MaxTailCalls > 0 && tailCalls > e.MaxTailCalls {
+				return tail.position(newError("尾调用次数过多: 超过%d次", e.MaxTailCalls))
+			}
+			if err := checkArity(fn, len(args)); err != nil {
+				return tail.position(err)
+			}
+			extendEnv, err := e.extendFunctionEnv(fn, args)
+			if err != nil {
+				return tail.position(err)
+			}
+			evaluated, next := e.evalTail(fn.Body, extendEnv, fn)
+			if next != nil && extendEnv.HasDeferred() {
+				// defer要在被调用的函数返回之后才执行，这时只能按普通的调用处理
+				evaluated = withPosition(e.applyFunction(fn, next.args), next.token)
+				next = nil
+			}
+			// 无论是正常返回、提前return还是出错，defer都要执行
+			if deferredErr := e.runDeferred(extendEnv); deferredErr != nil && !isError(evaluated) {
+				return deferredErr
+			}
+			if next == nil {
+				return unwrapReturnValue(evaluated)
+			}
+			if err := e.checkContext(); err != nil {
+				return err
+			}
+			tail, args = next, next.args
+		}
 	case *object.Builtin: // 内置的函数
 		return fn.Fn(args...)
+	case *evaluatorBuiltin: // 用到评估状态的内置函数，使用正在评估的Evaluator
+		return fn.fn(e, args...)
 	default:
 		return newError("不是一个函数: %s", fn.Type())
 	}
 }
 
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// isErrorBuiltin 内置的is_error，调用它时参数出错不中断评估
+var isErrorBuiltin = builtins["is_error"]
+
+// evalIsError is_error(x)的参数出错时不向上传播，而是返回true，这样脚本里才能判断表达式是否出错
+// exit不是错误，仍然结束评估
+func (e *Evaluator) evalIsError(exp ast.Expression, env *object.Environment) object.Object {
+	arg := e.Eval(exp, env)
+	if exit, ok := arg.(*object.Exit); ok {
+		return exit
+	}
+	return nativeBoolToBooleanObject(arg != nil && arg.Type() == object.ERROR_OBJ)
+}
+
+// tailCall 在尾部位置对正在执行的函数自身的调用，参数已经求值
+type tailCall struct {
+	args  []object.Object
+	token token.Token
+}
+
+// position 参数数量不对这类错误没有位置，用尾调用所在的位置；第一次调用时tc是nil，由调用方补上位置
+func (tc *tailCall) position(err object.Object) object.Object {
+	if tc == nil {
+		return err
+	}
+	return withPosition(err, tc.token)
+}
+
+// evalTail 评估处于函数体尾部位置的节点，遇到对fn自身的调用时不执行，而是返回求值后的参数交给applyFunction循环
+// 只有块的最后一条语句、if和三元表达式选中的分支、return的值处于尾部位置，其余节点按Eval评估
+func (e *Evaluator) evalTail(node ast.Node, env *object.Environment, fn *object.Function) (object.Object, *tailCall) {
+	if e.Trace == nil {
+		return e.evalTailNode(node, env, fn)
+	}
+	e.Trace.Enter(node)
+	result, tc := e.evalTailNode(node, env, fn)
+	e.Trace.Exit(node, result)
+	return result, tc
+}
+
+func (e *Evaluator) evalTailNode(node ast.Node, env *object.Environment, fn *object.Function) (object.Object, *tailCall) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if len(node.Statements) == 0 {
+			return NULL, nil
+		}
+		last := len(node.Statements) - 1
+		for _, stmt := range node.Statements[:last] {
+			result := e.Eval(stmt, env)
+			if result != nil {
+				rt := result.Type()
+				if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ || rt == object.EXIT_OBJ {
+					return result, nil
+				}
+			}
+		}
+		result, tc := e.evalTail(node.Statements[last], env, fn)
+		if result == nil && tc == nil {
+			return NULL, nil
+		}
+		return result, tc
+	case *ast.ExpressionStatement:
+		return e.evalTail(node.Expression, env, fn)
+	case *ast.ReturnStatement:
+		if node.ReturnValue == nil {
+			return e.eval(node, env), nil
+		}
+		val, tc := e.evalTail(node.ReturnValue, env, fn)
+		if tc != nil || isError(val) {
+			return val, tc
+		}
+		return &object.ReturnValue{Value: val}, nil
+	case *ast.IfExpression:
+		condition := e.Eval(node.Condition, env)
+		if isError(condition) {
+			return condition, nil
+		}
+		if isTruthy(condition) {
+			return e.evalTail(node.Consequence, env, fn)
+		}
+		if node.Alternative != nil {
+			return e.evalTail(node.Alternative, env, fn)
+		}
+		return NULL, nil
+	case *ast.TernaryExpression:
+		condition := e.Eval(node.Condition, env)
+		if isError(condition) {
+			return condition, nil
+		}
+		if isTruthy(condition) {
+			return e.evalTail(node.Consequence, env, fn)
+		}
+		return e.evalTail(node.Alternative, env, fn)
+	case *ast.CallExpression:
+		function := e.Eval(node.Function, env)
+		if isError(function) {
+			return function, nil
+		}
+		if function == isErrorBuiltin && len(node.Arguments) == 1 {
+			return e.evalIsError(node.Arguments[0], env), nil
+		}
+		args := e.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0], nil
+		}
+		if function == fn {
+			return nil, &tailCall{args: args, token: node.Token}
+		}
+		return withPosition(e.applyFunction(function, args), node.Token), nil
+	default:
+		return e.eval(node, env), nil
+	}
+}
+
+// runDeferred 按后进先出执行环境中登记的defer，所有defer都会执行，返回第一个出现的错误
+func (e *Evaluator) runDeferred(env *object.Environment) *object.Error {
+	var firstErr *object.Error
+	deferred := env.TakeDeferred()
+	for i := len(deferred) - 1; i >= 0; i-- {
+		result := e.Eval(deferred[i], env)
+		if err, ok := result.(*object.Error); ok && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// checkArity 检查参数数量，有默认值的参数可以省略，有可变参数时不限制上限
+func checkArity(fn *object.Function, count int) *object.Error {
+	required := len(fn.Parameters)
+	for i := range fn.Parameters {
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			required = i
+			break
+		}
+	}
+	switch {
+	case fn.Rest != nil:
+		if count < required {
+			return newError("参数数量不匹配: 期望至少%d个, 实际%d个", required, count)
+		}
+	case required == len(fn.Parameters):
+		if count != required {
+			return newError("参数数量不匹配: 期望%d个, 实际%d个", required, count)
+		}
+	default:
+		if count < required || count > len(fn.Parameters) {
+			return newError("参数数量不匹配: 期望%d到%d个, 实际%d个", required, len(fn.Parameters), count)
+		}
+	}
+	return nil
+}
+
+// extendFunctionEnv 创建函数调用的局部环境并绑定参数，省略的参数使用默认值，多余的参数收集到可变参数里
+// 默认值在正在构建的局部环境中求值，所以可以引用前面的参数 fn(a, b = a)
+func (e *Evaluator) extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, object.Object) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 	for paramIdx, param := range fn.Parameters {
+		if paramIdx >= len(args) && paramIdx < len(fn.Defaults) && fn.Defaults[paramIdx] != nil {
+			value := e.Eval(fn.Defaults[paramIdx], env)
+			if isError(value) {
+				return nil, value
+			}
+			env.Set(param.String(), value)
+			continue
+		}
 		// 变量命名，变量值绑定到函数调用的局部环境
 		env.Set(param.String(), args[paramIdx])
 	}
-	return env
+	if fn.Rest != nil {
+		// 固定参数之外的参数收集成数组，没有多余参数时是空数组
+		rest := make([]object.Object, 0)
+		if len(args) > len(fn.Parameters) {
+			rest = append(rest, args[len(fn.Parameters):]...)
+		}
+		env.Set(fn.Rest.String(), &object.Array{Elements: rest})
+	}
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -317,6 +1020,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -324,6 +1029,13 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	}
 }
 
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	if obj.Type() != object.HASH_OBJ {
+		return newError("不支持访问成员, %s.%s", obj.Type(), name)
+	}
+	return evalHashIndexExpression(obj, &object.String{Value: name})
+}
+
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	arrayObject := array.(*object.Array)
 	idx := index.(*object.Integer).Value
@@ -334,6 +1046,17 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	// 按rune取字符，避免把多字节的UTF-8字符截断
+	runes := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	max := int64(len(runes) - 1)
+	if idx < 0 || idx > max {
+		return NULL
+	}
+	return &object.String{Value: string(runes[idx])}
+}
+
 func evalHashIndexExpression(hash, index object.Object) object.Object {
 	hashObject := hash.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -347,10 +1070,10 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	return pair.Value
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
+		key := e.Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
@@ -358,7 +1081,7 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		if !ok {
 			return newError("无法作为哈希的键, %s", key.Type())
 		}
-		value := Eval(valueNode, env)
+		value := e.Eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
@@ -368,9 +1091,10 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 	return &object.Hash{Pairs: pairs}
 }
 
+// isError 错误和exit都要中断评估，原样返回给上层，直到顶层
 func isError(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR_OBJ
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.EXIT_OBJ
 	}
 	return false
 }
@@ -378,3 +1102,23 @@ func isError(obj object.Object) bool {
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
+
+// checkContext context被取消或超时时返回错误
+func (e *Evaluator) checkContext() *object.Error {
+	if e.ctx == nil {
+		return nil
+	}
+	if err := e.ctx.Err(); err != nil {
+		return newError("执行已取消: %s", err)
+	}
+	return nil
+}
+
+// withPosition 给还没有位置信息的错误补上出错节点的位置，已经有位置的说明是更内层产生的，保持不变
+func withPosition(obj object.Object, tok token.Token) object.Object {
+	if err, ok := obj.(*object.Error); ok && err.Line == 0 {
+		err.Line = tok.Line
+		err.Column = tok.Column
+	}
+	return obj
+}
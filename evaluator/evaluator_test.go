@@ -1,10 +1,21 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"interpreter/ast"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -39,6 +50,11 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1 != 1", false},
 		{"1 == 2", false},
 		{"1 != 2", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
 		{"true == true", true},
 		{"false == false", true},
 		{"true == false", false},
@@ -155,6 +171,12 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// testEvalWith 用指定的Evaluator评估，用于需要修改Output、Rand等设置的测试
+func testEvalWith(e *Evaluator, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return e.Eval(program, object.NewEnvironment())
+}
+
 func TestErrorHandling(t *testing.T) {
 	tests := []struct {
 		input           string
@@ -342,6 +364,11 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("你好")`, 2},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`len({})`, 0},
+		{`len(delete({"a": 1}, "a"))`, 0},
 		{`len(1)`, "len不支持的参数类型，INTEGER"},
 		{`len("one", "two")`, "入参数量不正确，需要1个，实际2个"},
 	}
@@ -529,3 +556,2714 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestWhileExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 5) { i = i + 1; }; i", 5},
+		{"let i = 0; let sum = 0; while (i < 4) { i = i + 1; sum = sum + i; }; sum", 10},
+		{"while (false) { 1 }", nil},
+		{
+			`
+let find = fn(target) {
+	let i = 0;
+	while (true) {
+		if (i == target) { return i * 10; }
+		i = i + 1;
+	}
+	return -1;
+};
+find(3);`,
+			30,
+		},
+		{
+			`
+let f = fn() {
+	let i = 0;
+	while (i < 10) {
+		while (true) {
+			return 7;
+		}
+		i = i + 1;
+	}
+	99;
+};
+f();`,
+			7,
+		},
+		{"let i = 0; while (true) { return 3; }; 4", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestWhileExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"while (true) { 1 + true; }", "类型不匹配: INTEGER + BOOLEAN"},
+		{"let f = fn() { while (true) { x } }; f();", "变量未定义: x"},
+		{"y = 1", "变量未定义: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; let b = 1; a = b = 3; a + b", 6},
+		{"let a = 1; let set = fn() { a = 5 }; set(); a", 5},
+		{"let a = 1; let shadow = fn() { let a = 2; a = 3; a }; shadow() + a", 4},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[1]`, "e"},
+		{`"hello"[4]`, "o"},
+		{`let s = "hello"; s[1 + 1]`, "l"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"你好"[1]`, "好"},
+		{`let s = "héllo"; s[len(s) - 1]`, "o"},
+		{`"hello"[5]`, nil},
+		{`"hello"[-1]`, nil},
+		{`""[0]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
+func TestCommafyBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`commafy(0)`, "0"},
+		{`commafy(7)`, "7"},
+		{`commafy(999)`, "999"},
+		{`commafy(1000)`, "1,000"},
+		{`commafy(123456)`, "123,456"},
+		{`commafy(1234567)`, "1,234,567"},
+		{`commafy(-1234567)`, "-1,234,567"},
+		{`commafy(-12)`, "-12"},
+		{`commafy(-9223372036854775807 - 1)`, "-9,223,372,036,854,775,808"},
+		{`commafy(1234567, "_")`, "1_234_567"},
+		{`commafy(1234567, "")`, "1234567"},
+		{`commafy("1")`, errorResult("commafy不支持的参数类型，STRING")},
+		{`commafy(1, 2)`, errorResult("commafy不支持的参数类型，INTEGER")},
+		{`commafy()`, errorResult("入参数量不正确，需要1到2个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// errorResult 期望得到一个错误对象，用于区分期望的字符串结果
+type errorResult string
+
+// inspected 期望对象的Inspect结果，用于比较嵌套的数组、哈希
+type inspected string
+
+func testObject(t *testing.T, obj object.Object, expected interface{}) bool {
+	switch expected := expected.(type) {
+	case int:
+		return testIntegerObject(t, obj, int64(expected))
+	case float64:
+		return testFloatObject(t, obj, expected)
+	case bool:
+		return testBooleanObject(t, obj, expected)
+	case string:
+		return testStringObject(t, obj, expected)
+	case errorResult:
+		return testErrorObject(t, obj, string(expected))
+	case inspected:
+		if obj == nil || obj.Inspect() != string(expected) {
+			t.Errorf("object has wrong Inspect. want=%q, got=%+v", expected, obj)
+			return false
+		}
+		return true
+	case []int64:
+		return testIntegerArrayObject(t, obj, expected)
+	case nil:
+		return testNullObject(t, obj)
+	}
+	t.Errorf("type of expected not handled. got=%T", expected)
+	return false
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("object is not Error. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q",
+			expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestMapBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`map([], fn(x) { x * 2 })`, []int64{}},
+		{`let double = fn(x) { x * 2 }; map(map([1, 2], double), double)`, []int64{4, 8}},
+		{`map(["a", "bb"], len)`, []int64{1, 2}},
+		{`map([1, true, 3], fn(x) { x + 1 })`, errorResult("类型不匹配: BOOLEAN + INTEGER")},
+		{`map([1, 2], fn(x) { return y; })`, errorResult("变量未定义: y")},
+		{`map(1, fn(x) { x })`, errorResult("map不支持的参数类型，INTEGER")},
+		{`map([1], 1)`, errorResult("map不支持的参数类型，INTEGER")},
+		{`map([1])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func testIntegerArrayObject(t *testing.T, obj object.Object, expected []int64) bool {
+	arr, ok := obj.(*object.Array)
+	if !ok {
+		t.Errorf("object is not Array. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if len(arr.Elements) != len(expected) {
+		t.Errorf("wrong num of elements. want=%d, got=%d",
+			len(expected), len(arr.Elements))
+		return false
+	}
+	for i, expectedElem := range expected {
+		if !testIntegerObject(t, arr.Elements[i], expectedElem) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDeferStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{
+			`let log = "";
+let f = fn() {
+	defer log = log + "a";
+	defer log = log + "b";
+	log = log + "c";
+};
+f();
+log`,
+			"cba",
+		},
+		{
+			`let log = "";
+let f = fn(x) {
+	defer log = log + "d";
+	if (x > 0) { return x; }
+	defer log = log + "late";
+	0;
+};
+f(5);
+log`,
+			"d",
+		},
+		{
+			`let n = 0;
+let f = fn() { defer n = n + 1; 7 };
+let r = f();
+n + r`,
+			8,
+		},
+		{`let f = fn() { defer missing; 1 }; f();`, errorResult("变量未定义: missing")},
+		{`let n = 1; defer n = n * 10; n`, 1},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDeferRunsOnError(t *testing.T) {
+	input := `let log = "";
+let f = fn() {
+	defer log = log + "cleanup";
+	1 + true;
+};
+f();`
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+	testErrorObject(t, Eval(program, env), "类型不匹配: INTEGER + BOOLEAN")
+
+	log, _ := env.Get("log")
+	testStringObject(t, log, "cleanup")
+}
+
+func TestFilterBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`filter([1, 2, 3, 4], fn(x) { x / 2 * 2 == x })`, []int64{2, 4}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 10 })`, []int64{}},
+		{`filter([], fn(x) { true })`, []int64{}},
+		{`filter([1, 2, 3], fn(x) { x })`, []int64{1, 2, 3}},
+		{`filter([1, 2, 3], fn(x) { if (x == 2) { 1 } })`, []int64{2}},
+		{`filter([1, 2], fn(x) { x + true })`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`filter("abc", fn(x) { true })`, errorResult("filter不支持的参数类型，STRING")},
+		{`filter([1], "fn")`, errorResult("filter不支持的参数类型，STRING")},
+		{`filter([1], fn(x) { true }, 1)`, errorResult("入参数量不正确，需要2个，实际3个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestChunkByBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`chunk_by([1, 3, 2, 4, 5], fn(x) { x / 2 * 2 == x })`, inspected("[[1, 3], [2, 4], [5]]")},
+		{`chunk_by([1, 2, 3, 4], fn(x) { x / 2 * 2 == x })`, inspected("[[1], [2], [3], [4]]")},
+		{`chunk_by([1, 2, 3], fn(x) { "same" })`, inspected("[[1, 2, 3]]")},
+		{`chunk_by(["a", "b", "cc", "dd", "e"], len)`, inspected("[[a, b], [cc, dd], [e]]")},
+		{`chunk_by([], fn(x) { x })`, inspected("[]")},
+		{`chunk_by([1, 1.5, 2, 3], fn(x) { x * 0.5 > 0.6 })`, inspected("[[1], [1.5, 2, 3]]")},
+		{`chunk_by([1, 2, 3], fn(x) { x < 3 ? 1 : 1.0 })`, inspected("[[1, 2, 3]]")},
+		{`chunk_by([1, 2], fn(x) { x + "a" })`, errorResult("类型不匹配: INTEGER + STRING")},
+		{`chunk_by(1, fn(x) { x })`, errorResult("chunk_by不支持的参数类型，INTEGER")},
+		{`chunk_by([1])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestReduceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 5, fn(acc, x) { acc + x })`, 5},
+		{`reduce(["a", "b", "c"], "", fn(acc, x) { acc + x })`, "abc"},
+		{`reduce([1, 2, 3], [], push)`, []int64{1, 2, 3}},
+		{`reduce([1, "b"], 0, fn(acc, x) { acc + x })`, errorResult("类型不匹配: INTEGER + STRING")},
+		{`reduce({}, 0, fn(acc, x) { acc })`, errorResult("reduce不支持的参数类型，HASH")},
+		{`reduce([1], 0, 0)`, errorResult("reduce不支持的参数类型，INTEGER")},
+		{`reduce([1], fn(acc, x) { acc })`, errorResult("入参数量不正确，需要3个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEvalAndCollect(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("existing", &object.Integer{Value: 1})
+
+	input := `let a = 5;
+let b = "two";
+let add = fn(x, y) { let inner = x; x + y };
+existing = 2;
+add(a, 3);`
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	result, bindings := EvalAndCollect(program, env)
+	testIntegerObject(t, result, 8)
+
+	if len(bindings) != 3 {
+		t.Fatalf("wrong num of bindings. want=3, got=%d (%v)", len(bindings), bindings)
+	}
+	testIntegerObject(t, bindings["a"], 5)
+	testStringObject(t, bindings["b"], "two")
+	if _, ok := bindings["add"].(*object.Function); !ok {
+		t.Errorf("binding add is not Function. got=%T", bindings["add"])
+	}
+	if _, ok := bindings["existing"]; ok {
+		t.Errorf("binding existing should not be collected")
+	}
+	if _, ok := bindings["inner"]; ok {
+		t.Errorf("binding inner should not be collected")
+	}
+}
+
+func TestKeysAndValuesBuiltins(t *testing.T) {
+	// 哈希遍历顺序是随机的，keys/values按键的Inspect排序，键相同时按类型排序
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`keys({"b": 2, "a": 1, "c": 3})`, inspected("[a, b, c]")},
+		{`values({"b": 2, "a": 1, "c": 3})`, inspected("[1, 2, 3]")},
+		{`keys({2: "x", "1": "y", true: "z", 1: "w"})`, inspected("[1, 1, 2, true]")},
+		{`values({2: "x", "1": "y", true: "z", 1: "w"})`, inspected("[w, y, x, z]")},
+		{`keys({})`, inspected("[]")},
+		{`values({})`, inspected("[]")},
+		{`keys([1])`, errorResult("keys不支持的参数类型，ARRAY")},
+		{`values(1)`, errorResult("values不支持的参数类型，INTEGER")},
+		{`keys({}, {})`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestDeleteBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`keys(delete({"a": 1, "b": 2}, "a"))`, inspected("[b]")},
+		{`keys(delete({"a": 1, 2: 2, true: 3}, 2))`, inspected("[a, true]")},
+		{`keys(delete({"a": 1, "b": 2}, "c"))`, inspected("[a, b]")},
+		{`keys(delete({}, "c"))`, inspected("[]")},
+		{`let h = {"a": 1, "b": 2}; let d = delete(h, "a"); len(keys(h))`, 2},
+		{`let h = {"a": 1}; delete(h, "a")["a"]`, nil},
+		{`delete({"a": 1}, [1])`, errorResult("无法作为哈希的键, ARRAY")},
+		{`delete({"a": 1}, fn(x) { x })`, errorResult("无法作为哈希的键, FUNCTION")},
+		{`delete([1], 0)`, errorResult("delete不支持的参数类型，ARRAY")},
+		{`delete({"a": 1})`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypeBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`type(1)`, "INTEGER"},
+		{`type(true)`, "BOOLEAN"},
+		{`type("a")`, "STRING"},
+		{`type([1])`, "ARRAY"},
+		{`type({"a": 1})`, "HASH"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(type(1))`, "STRING"},
+		{`type(1 + true)`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`type()`, errorResult("入参数量不正确，需要1个，实际0个")},
+		{`type(1, 2)`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIntAndStrBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`int("42")`, 42},
+		{`int("-7")`, -7},
+		{`int(5)`, 5},
+		{`int("42") + 1`, 43},
+		{`int("3.5")`, errorResult(`无法将 "3.5" 转换为整数`)},
+		{`int("abc")`, errorResult(`无法将 "abc" 转换为整数`)},
+		{`int("")`, errorResult(`无法将 "" 转换为整数`)},
+		{`int(true)`, errorResult("int不支持的参数类型，BOOLEAN")},
+		{`int()`, errorResult("入参数量不正确，需要1个，实际0个")},
+		{`str(42)`, "42"},
+		{`str(-1)`, "-1"},
+		{`str(true)`, "true"},
+		{`str("abc")`, "abc"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str(if (false) { 1 })`, "null"},
+		{`str(int("7"))`, "7"},
+		{`int(str(7))`, 7},
+		{`str(1, 2)`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSplitBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`split("a,b,c", ",")`, inspected("[a, b, c]")},
+		{`len(split("a,b,c", ","))`, 3},
+		{`split("a, b", ", ")`, inspected("[a, b]")},
+		{`split("abc", "")`, inspected("[a, b, c]")},
+		{`split("héllo", "")[1]`, "é"},
+		{`split("abc", ";")`, inspected("[abc]")},
+		{`len(split("", ","))`, 1},
+		{`split(",a,", ",")[0]`, ""},
+		{`split(1, ",")`, errorResult("split不支持的参数类型，INTEGER")},
+		{`split("a", 1)`, errorResult("split不支持的参数类型，INTEGER")},
+		{`split("a")`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestJoinBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`join(["a", "b"], "-")`, "a-b"},
+		{`join(["a", "b", "c"], "")`, "abc"},
+		{`join(["a"], ", ")`, "a"},
+		{`join([], ",")`, ""},
+		{`join(split("a,b,c", ","), ";")`, "a;b;c"},
+		{`join(["a", 1], ",")`, errorResult("join的数组元素必须是字符串，第2个是INTEGER")},
+		{`join([1, "a"], ",")`, errorResult("join的数组元素必须是字符串，第1个是INTEGER")},
+		{`join("ab", ",")`, errorResult("join不支持的参数类型，STRING")},
+		{`join(["a"], 1)`, errorResult("join不支持的参数类型，INTEGER")},
+		{`join(["a"])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLine    int
+		expectedColumn  int
+		expectedInspect string
+	}{
+		{
+			`let f = fn() {
+	if (true) {
+		let a = 1;
+		a + missing;
+	}
+};
+f();`,
+			4, 7,
+			"ERROR: 第4行: 变量未定义: missing",
+		},
+		{"let a = 1;\n\na + true;", 3, 3, "ERROR: 第3行: 类型不匹配: INTEGER + BOOLEAN"},
+		{"let a = 1;\n  a(2);", 2, 4, "ERROR: 第2行: 不是一个函数: INTEGER"},
+		{"len(1)", 1, 4, "ERROR: 第1行: len不支持的参数类型，INTEGER"},
+		{"\n-true", 2, 1, "ERROR: 第2行: 未知的操作: -BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Line != tt.expectedLine || errObj.Column != tt.expectedColumn {
+			t.Errorf("wrong error position. want=%d:%d, got=%d:%d",
+				tt.expectedLine, tt.expectedColumn, errObj.Line, errObj.Column)
+		}
+		if errObj.Inspect() != tt.expectedInspect {
+			t.Errorf("wrong Inspect. want=%q, got=%q", tt.expectedInspect, errObj.Inspect())
+		}
+	}
+}
+
+func TestPrintBuiltin(t *testing.T) {
+	tests := []struct {
+		input          string
+		expected       interface{}
+		expectedOutput string
+	}{
+		{`print(5)`, 5, "5"},
+		{`let x = print(2 * 3); x + 1`, 7, "6"},
+		{`print("a") + print("b")`, "ab", "ab"},
+		{`len(print([1, 2]))`, 2, "[1, 2]"},
+		{`print()`, errorResult("入参数量不正确，需要1个，实际0个"), ""},
+		{`print(1, 2)`, errorResult("入参数量不正确，需要1个，实际2个"), ""},
+	}
+
+	for _, tt := range tests {
+		evaluated, output := captureOutput(tt.input)
+		testObject(t, evaluated, tt.expected)
+		if output != tt.expectedOutput {
+			t.Errorf("wrong output. want=%q, got=%q", tt.expectedOutput, output)
+		}
+	}
+
+	// 返回的就是传入的对象本身
+	arg := &object.Integer{Value: 1}
+	e := New()
+	e.Output = &bytes.Buffer{}
+	if evaluatorBuiltins["print"].fn(e, arg) != arg {
+		t.Errorf("print did not return its argument")
+	}
+}
+
+// captureOutput 评估input，同时返回puts、print的输出
+func captureOutput(input string) (object.Object, string) {
+	var buf bytes.Buffer
+	e := New()
+	e.Output = &buf
+	evaluated := testEvalWith(e, input)
+	return evaluated, buf.String()
+}
+
+func TestPutsBuiltin(t *testing.T) {
+	evaluated, output := captureOutput(`puts("hi"); puts(1, [2, 3]); puts()`)
+	testNullObject(t, evaluated)
+	if output != "hi\n1\n[2, 3]\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	tests := []string{
+		"let f = fn(x) { f(x + 1) }; f(0);",
+		"let i = 0; while (true) { i = i + 1; }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+
+		// 关掉调用深度限制，验证无限递归靠context终止
+		e := New()
+		e.MaxCallDepth = 0
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		evaluated := e.EvalContext(ctx, program, object.NewEnvironment())
+		cancel()
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if !strings.HasPrefix(errObj.Message, "执行已取消") {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+	}
+}
+
+func TestEvalContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	l := lexer.New("let f = fn() { 1 }; f();")
+	p := parser.New(l)
+	evaluated := EvalContext(ctx, p.ParseProgram(), object.NewEnvironment())
+	testErrorObject(t, evaluated, "执行已取消: context canceled")
+
+	// 不带context的评估不受影响
+	testIntegerObject(t, testEval("let f = fn() { 1 }; f();"), 1)
+}
+
+func TestEvalContextConcurrent(t *testing.T) {
+	// 一个评估超时被取消，同时进行的另一个评估不受影响
+	parse := func(input string) *ast.Program {
+		return parser.New(lexer.New(input)).ParseProgram()
+	}
+	cancelled := parse("let i = 0; while (true) { i = i + 1; }")
+	plain := parse("sleep(50); let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(100);")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var first, second object.Object
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		first = EvalContext(ctx, cancelled, object.NewEnvironment())
+	}()
+	go func() {
+		defer wg.Done()
+		second = Eval(plain, object.NewEnvironment())
+	}()
+	wg.Wait()
+
+	testErrorObject(t, first, "执行已取消: context deadline exceeded")
+	testIntegerObject(t, second, 5050)
+}
+
+func TestBuiltinValuesUseCallingEvaluator(t *testing.T) {
+	// partial这类返回的函数放在环境里，被其他Evaluator调用时用的是调用它的Evaluator
+	base := object.NewEnvironment()
+	setup := "let mul = fn(a, b) { a * b }; let double = partial(mul, 2); let spin = fn(n) { while (true) { n = n + 1 } }; let s = partial(spin, 2);"
+	New().Eval(parser.New(lexer.New(setup)).ParseProgram(), base)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	evaluated := New().EvalContext(ctx, parser.New(lexer.New("s()")).ParseProgram(), base.Clone())
+	testErrorObject(t, evaluated, "执行已取消: context deadline exceeded")
+
+	program := parser.New(lexer.New("let f = fn(n) { n == 0 ? 0 : double(n) - 2 + f(n - 1) }; f(100)")).ParseProgram()
+	results := make([]object.Object, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = New().Eval(program, base.Clone())
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range results {
+		testIntegerObject(t, result, 9900)
+	}
+}
+
+func TestCallDepthLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(x) { f(x + 1) + 1 }; f(0);", errorResult("调用栈过深: 超过1000层")},
+		{"let f = fn(n) { if (n == 1) { 1 } else { 1 + f(n - 1) } }; f(1000);", 1000},
+		{"let f = fn(n) { if (n == 1) { 1 } else { 1 + f(n - 1) } }; f(1001);", errorResult("调用栈过深: 超过1000层")},
+		{"let f = fn(n) { if (n == 1) { 1 } else { 1 + f(n - 1) } }; f(1000);", 1000},
+	}
+
+	// 同一个Evaluator连续评估，每次结束后调用层数都要恢复
+	e := New()
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		testObject(t, e.Eval(program, object.NewEnvironment()), tt.expected)
+		if e.depth != 0 {
+			t.Errorf("depth not restored. got=%d", e.depth)
+			e.depth = 0
+		}
+	}
+}
+
+func TestTailCallLimit(t *testing.T) {
+	e := New()
+	e.MaxTailCalls = 100
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = fn(n, acc) { n == 0 ? acc : sum(n - 1, acc + n) }; sum(100, 0)", 5050},
+		{"let sum = fn(n, acc) { n == 0 ? acc : sum(n - 1, acc + n) }; sum(101, 0)", errorResult("尾调用次数过多: 超过100次")},
+		{"let f = fn(n) { f(n) }; f(1)", errorResult("尾调用次数过多: 超过100次")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+}
+
+func TestCallDepthConcurrent(t *testing.T) {
+	// 每个评估单独计算调用层数，同时进行的评估不会互相占用
+	program := parser.New(lexer.New("let f = fn(n) { if (n == 1) { 1 } else { 1 + f(n - 1) } }; f(700);")).ParseProgram()
+	results := make([]object.Object, 4)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = Eval(program, object.NewEnvironment())
+		}(i)
+	}
+	wg.Wait()
+	for _, result := range results {
+		testIntegerObject(t, result, 700)
+	}
+}
+
+func TestCachedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 == 1", true},
+		{"256 == 255 + 1", true},
+		{"257 == 256 + 1", true},
+		{"-128 == -127 - 1", true},
+		{"-129 == -128 - 1", true},
+		{"100000 == 99999 + 1", true},
+		{"1 == 2", false},
+		{"[1][0] == 1", true},
+	}
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	if newInteger(5) != newInteger(5) || newInteger(-128) != newInteger(-128) {
+		t.Errorf("small integers should be cached")
+	}
+	if newInteger(257) == newInteger(257) || newInteger(-129) == newInteger(-129) {
+		t.Errorf("integers outside the cached range should be allocated")
+	}
+	testIntegerObject(t, newInteger(-128), -128)
+	testIntegerObject(t, newInteger(256), 256)
+	testIntegerObject(t, newInteger(1000), 1000)
+}
+
+func BenchmarkSumLoop(b *testing.B) {
+	// 同样的循环，cached的值都在小整数缓存的范围内，uncached整体加上1000，每次运算都要分配新对象
+	template := `let round = %[1]d;
+while (round < %[1]d + 200) {
+	let i = %[1]d;
+	let sum = %[1]d;
+	while (i < %[1]d + 20) {
+		i = i + 1;
+		sum = sum + (i - %[1]d);
+	}
+	round = round + 1;
+}
+sum;`
+	run := func(offset int) func(b *testing.B) {
+		program := parser.New(lexer.New(fmt.Sprintf(template, offset))).ParseProgram()
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Eval(program, object.NewEnvironment())
+			}
+		}
+	}
+	b.Run("cached", run(0))
+	b.Run("uncached", run(1000))
+}
+
+func TestSortBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sort([3, 1, 2])`, []int64{1, 2, 3}},
+		{`sort([5, -1, 5, 0])`, []int64{-1, 0, 5, 5}},
+		{`sort([])`, []int64{}},
+		{`sort(["pear", "apple", "fig"])`, inspected("[apple, fig, pear]")},
+		{`let a = [3, 1, 2]; let b = sort(a); a`, []int64{3, 1, 2}},
+		{`sort([3, 1, 2], fn(a, b) { b - a })`, []int64{3, 2, 1}},
+		{`sort(["ccc", "a", "bb"], fn(a, b) { len(a) - len(b) })`, inspected("[a, bb, ccc]")},
+		{`sort([[2], [1]], fn(a, b) { a[0] - b[0] })`, inspected("[[1], [2]]")},
+		{`sort([1, "a"])`, errorResult("sort的数组元素类型不一致: INTEGER 与 STRING")},
+		{`sort([true, false])`, errorResult("sort不支持的元素类型，BOOLEAN")},
+		{`sort([1, 2], fn(a, b) { a < b })`, errorResult("sort的比较函数必须返回整数，实际返回BOOLEAN")},
+		{`sort([1, 2], fn(a, b) { a + true })`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`sort("abc")`, errorResult("sort不支持的参数类型，STRING")},
+		{`sort([1], 1)`, errorResult("sort不支持的参数类型，INTEGER")},
+		{`sort()`, errorResult("入参数量不正确，需要1到2个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestContainsBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`contains([1, 2, 3], 2)`, true},
+		{`contains([1, 2, 3], 4)`, false},
+		{`contains(["a", "b"], "b")`, true},
+		{`contains(["a", "b"], "c")`, false},
+		{`contains([true], true)`, true},
+		{`contains([1], "1")`, false},
+		{`contains([1.5], 1.5)`, true},
+		{`contains([1.5], 2.5)`, false},
+		{`contains([1], 1.0)`, true},
+		{`contains([2.0], 2)`, true},
+		{`contains([null], null)`, true},
+		{`contains([], 1)`, false},
+		{`let f = fn() { 1 }; contains([f], f)`, true},
+		{`contains([fn() { 1 }], fn() { 1 })`, false},
+		{`contains("hello", "ell")`, true},
+		{`contains("hello", "")`, true},
+		{`contains("hello", "world")`, false},
+		{`contains({"a": 1, 2: 3}, "a")`, true},
+		{`contains({"a": 1, 2: 3}, 2)`, true},
+		{`contains({"a": 1}, "b")`, false},
+		{`contains({"a": 1}, [1])`, errorResult("无法作为哈希的键, ARRAY")},
+		{`contains("hello", 1)`, errorResult("contains不支持的参数类型，INTEGER")},
+		{`contains(1, 1)`, errorResult("contains不支持的参数类型，INTEGER")},
+		{`contains([1])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[] == []", true},
+		{`[1, "a", true] == [1, "a", true]`, true},
+		{"[[1, [2]], 3] == [[1, [2]], 3]", true},
+		{"[[1, [2]], 3] == [[1, [3]], 3]", false},
+		{"[1] == [true]", false},
+		{"let a = [1]; a == a", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{"a": {"b": [1]}} != {"a": {"b": [1]}}`, false},
+		{`{} == {}`, true},
+		{`[1] == {}`, false},
+		{`let f = fn() { 1 }; f == f`, true},
+		{`fn() { 1 } == fn() { 1 }`, false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; const b = a * 2; b;", 10},
+		{"const a = 5; a = 6;", errorResult("无法重新赋值常量: a")},
+		{"const a = 5; let a = 6;", errorResult("无法重新赋值常量: a")},
+		{"const a = 5; const a = 6;", errorResult("无法重新赋值常量: a")},
+		{"const a = 5; let f = fn() { a = 6 }; f();", errorResult("无法重新赋值常量: a")},
+		{"const a = 5; let f = fn() { let a = 6; a }; f() + a;", 11},
+		{"const a = 5; let f = fn() { let a = 6; a = 7; a }; f();", 7},
+		{"const a = 5; let f = fn(a) { a = a + 1; a }; f(1);", 2},
+		{"let a = 1; const b = 2; a = 3; a + b;", 5},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNullLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"null", nil},
+		{"let x = null; x", nil},
+		{"null == null", true},
+		{"null != null", false},
+		{"null == 0", false},
+		{"null == false", false},
+		{"if (false) { 1 } == null", true},
+		{"let x = null; if (x == null) { 1 } else { 2 }", 1},
+		{"let x = 5; if (x == null) { 1 } else { 2 }", 2},
+		{"if (null) { 1 } else { 2 }", 2},
+		{"!null", true},
+		{`type(null)`, "NULL"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	_, output := captureOutput("puts(null)")
+	if output != "null\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"5 / 0", errorResult("除以零")},
+		{"let x = 0; 10 / x", errorResult("除以零")},
+		{"let f = fn(a, b) { a / b }; f(1, 0)", errorResult("除以零")},
+		{"0 / 5", 0},
+		{"-10 / 3", -3},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 0xFF; x", 255},
+		{"0Xff", 255},
+		{"0o17", 15},
+		{"017", 15},
+		{"0b101", 5},
+		{"0B11 + 0x10", 19},
+		{"-0x10", -16},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIntegerLiteralUnderscores(t *testing.T) {
+	testIntegerObject(t, testEval("let n = 1_000_000; n + 1"), 1000001)
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"ab" < "abc"`, true},
+		{`"abc" > "ab"`, true},
+		{`"ab" <= "ab"`, true},
+		{`"ab" >= "abc"`, false},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`let a = "x" + "y"; a == "xy"`, true},
+		{`"B" < "a"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStringRepetition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`3 * "ab"`, "ababab"},
+		{`"-" * 1`, "-"},
+		{`"ab" * 0`, ""},
+		{`"" * 5`, ""},
+		{`let sep = "=" * 2 + "|"; sep`, "==|"},
+		{`"ab" * -1`, errorResult("字符串重复次数不能为负数: -1")},
+		{`-2 * "ab"`, errorResult("字符串重复次数不能为负数: -2")},
+		{`"ab" * 4611686018427387904`, errorResult("字符串重复结果过长")},
+		{`"ab" / 2`, errorResult("类型不匹配: STRING / INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAbsBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`abs(5)`, 5},
+		{`abs(-5)`, 5},
+		{`abs(0)`, 0},
+		{`abs(9223372036854775807)`, 9223372036854775807},
+		{`abs(-9223372036854775807)`, 9223372036854775807},
+		{`abs(-9223372036854775807 - 1)`, errorResult("abs结果溢出: -9223372036854775808")},
+		{`abs(-1.5)`, 1.5},
+		{`abs(2.5)`, 2.5},
+		{`abs(0.0 - 0.0)`, 0.0},
+		{`abs("1")`, errorResult("abs不支持的参数类型，STRING")},
+		{`abs()`, errorResult("入参数量不正确，需要1个，实际0个")},
+		{`abs(1, 2)`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMinMaxBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`max(3, 7, 2)`, 7},
+		{`min(3, 7, 2)`, 2},
+		{`max(-3, -7)`, -3},
+		{`min(5)`, 5},
+		{`max(5)`, 5},
+		{`max([3, 7, 2])`, 7},
+		{`min([3, 7, 2])`, 2},
+		{`min([4])`, 4},
+		{`max(1, 2.5)`, 2.5},
+		{`min(1, 2.5)`, 1.0},
+		{`min([0.5, -1.5, 2])`, -1.5},
+		{`max([1.5, 3, 2])`, 3.0},
+		{`type(max(1, 2.5, 3))`, "FLOAT"},
+		{`max(9007199254740993, 9007199254740992)`, 9007199254740993},
+		{`max([])`, errorResult("max的数组不能为空")},
+		{`max()`, errorResult("入参数量不正确，至少需要1个，实际0个")},
+		{`min(1, "2")`, errorResult("min不支持的参数类型，STRING")},
+		{`max([1, true])`, errorResult("max不支持的参数类型，BOOLEAN")},
+		{`max([1], [2])`, errorResult("max不支持的参数类型，ARRAY")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSumBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sum([1, 2, 3, 4])`, 10},
+		{`sum([-5, 5, 10])`, 10},
+		{`sum([])`, 0},
+		{`sum([1.5, 2])`, 3.5},
+		{`sum([0.25, 0.25])`, 0.5},
+		{`sum([1, 2.0])`, 3.0},
+		{`type(sum([1, 2.0]))`, "FLOAT"},
+		{`sum([1, "2", 3])`, errorResult("sum的数组元素必须是数字，第2个是STRING")},
+		{`sum(["1"])`, errorResult("sum的数组元素必须是数字，第1个是STRING")},
+		{`sum(1)`, errorResult("sum不支持的参数类型，INTEGER")},
+		{`sum()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUpperLowerBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`upper("abc")`, "ABC"},
+		{`lower("ABC")`, "abc"},
+		{`upper("ABC")`, "ABC"},
+		{`lower("abc")`, "abc"},
+		{`upper("MiXeD 1")`, "MIXED 1"},
+		{`lower("MiXeD 1")`, "mixed 1"},
+		{`upper("")`, ""},
+		// strings.ToUpper按单个rune映射，ß没有单字符的大写形式，保持不变
+		{`upper("Straße")`, "STRAßE"},
+		{`lower("STRAßE")`, "straße"},
+		{`lower("ÄÖÜ")`, "äöü"},
+		{`upper(1)`, errorResult("upper不支持的参数类型，INTEGER")},
+		{`lower("a", "b")`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTrimBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`trim("  hi  ")`, "hi"},
+		{"trim(\"\thi\n\")", "hi"},
+		{`trim("hi")`, "hi"},
+		{`trim("   ")`, ""},
+		{`trim("xxhixx", "x")`, "hi"},
+		{`trim("-=hi=-", "=-")`, "hi"},
+		{`trim("hi", "x")`, "hi"},
+		{`trim("  hi  ", "")`, "  hi  "},
+		{`trim(1)`, errorResult("trim不支持的参数类型，INTEGER")},
+		{`trim("hi", 1)`, errorResult("trim不支持的参数类型，INTEGER")},
+		{`trim()`, errorResult("入参数量不正确，需要1到2个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestReplaceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`replace("hello world", "world", "monkey")`, "hello monkey"},
+		{`replace("abc", "x", "y")`, "abc"},
+		{`replace("aaa", "a", "")`, ""},
+		{`replace("", "a", "b")`, ""},
+		{`replace("abc", "", "-")`, "-a-b-c-"},
+		{`replace("你好", "", "|")`, "|你|好|"},
+		{`replace("abc", "b", 1)`, errorResult("replace不支持的参数类型，INTEGER")},
+		{`replace("abc", "b")`, errorResult("入参数量不正确，需要3个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestIndexOfBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`index_of("hello", "ll")`, 2},
+		{`index_of("hello", "l")`, 2},
+		{`index_of("hello", "h")`, 0},
+		{`index_of("hello", "z")`, -1},
+		{`index_of("hello", "")`, 0},
+		{`index_of("", "a")`, -1},
+		{`index_of("你好世界", "世")`, 2},
+		{`index_of([1, 2, 3], 2)`, 1},
+		{`index_of(["a", "b"], "b")`, 1},
+		{`index_of([true, false], false)`, 1},
+		{`index_of([1, 2, 3], 4)`, -1},
+		{`index_of([1, 2, 3], "1")`, -1},
+		{`index_of([0.5, 1.5], 1.5)`, 1},
+		{`index_of([1, 2, 3], 2.0)`, 1},
+		{`index_of([], 1)`, -1},
+		{`index_of("123", 1)`, errorResult("index_of不支持的参数类型，INTEGER")},
+		{`index_of(1, 1)`, errorResult("index_of不支持的参数类型，INTEGER")},
+		{`index_of([1])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSliceBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`slice([1, 2, 3, 4], 1, 3)`, []int64{2, 3}},
+		{`slice([1, 2, 3, 4], 2)`, []int64{3, 4}},
+		{`slice([1, 2, 3, 4], 0, 100)`, []int64{1, 2, 3, 4}},
+		{`slice([1, 2, 3, 4], -100, 2)`, []int64{1, 2}},
+		{`slice([1, 2, 3, 4], -2)`, []int64{3, 4}},
+		{`slice([1, 2, 3, 4], 1, -1)`, []int64{2, 3}},
+		{`slice([1, 2, 3, 4], 3, 1)`, []int64{}},
+		{`slice([1, 2, 3, 4], 10)`, []int64{}},
+		{`slice([], 0, 1)`, []int64{}},
+		{`slice("hello", 1, 3)`, "el"},
+		{`slice("hello", 3)`, "lo"},
+		{`slice("hello", -3, 100)`, "llo"},
+		{`slice("hello", 2, 2)`, ""},
+		{`slice("你好世界", 1, 3)`, "好世"},
+		{`slice(1, 0)`, errorResult("slice不支持的参数类型，INTEGER")},
+		{`slice("abc", "1")`, errorResult("slice不支持的参数类型，STRING")},
+		{`slice("abc", 0, true)`, errorResult("slice不支持的参数类型，BOOLEAN")},
+		{`slice("abc")`, errorResult("入参数量不正确，需要2到3个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPopBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`pop([1, 2, 3])`, inspected("[3, [1, 2]]")},
+		{`pop([1])`, inspected("[1, []]")},
+		{`pop([])`, nil},
+		{`let a = [1, 2, 3]; let p = pop(a); a`, []int64{1, 2, 3}},
+		{`let p = pop([1, 2, 3]); p[0]`, 3},
+		{`pop(1)`, errorResult("pop不支持的参数类型，INTEGER")},
+		{`pop([1], [2])`, errorResult("入参数量不正确，需要1个，实际2个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFileBuiltins(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	testErrorObject(t, testEval(fmt.Sprintf(`read_file(%q)`, path)), "文件读写未开启")
+	testErrorObject(t, testEval(fmt.Sprintf(`write_file(%q, "x")`, path)), "文件读写未开启")
+
+	e := New()
+	e.EnableFileIO = true
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{fmt.Sprintf(`write_file(%q, "hello 你好")`, path), 12},
+		{fmt.Sprintf(`read_file(%q)`, path), "hello 你好"},
+		{fmt.Sprintf(`write_file(%q, ""); read_file(%q)`, path, path), ""},
+		{fmt.Sprintf(`len(read_file(%q))`, missing), errorResult(fmt.Sprintf("读取文件失败: open %s: no such file or directory", missing))},
+		{`read_file(1)`, errorResult("read_file不支持的参数类型，INTEGER")},
+		{fmt.Sprintf(`write_file(%q, 1)`, path), errorResult("write_file不支持的参数类型，INTEGER")},
+		{`write_file("a")`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+}
+
+func TestFormatBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`format("x={} y={}", 1, 2)`, "x=1 y=2"},
+		{`format("hello {}!", "monkey")`, "hello monkey!"},
+		{`format("{}{}", [1, 2], true)`, "[1, 2]true"},
+		{`format("no placeholders")`, "no placeholders"},
+		{`format("")`, ""},
+		{`format("{{}} is {}", "literal")`, "{} is literal"},
+		{`format("{{{}}}", 1)`, "{1}"},
+		{`format("a { b } c")`, "a { b } c"},
+		{`format("你好{}", "世界")`, "你好世界"},
+		{`format("x={} y={}", 1)`, errorResult("format参数不足，占位符多于1个参数")},
+		{`format("x={}", 1, 2)`, errorResult("format参数过多，需要1个，实际2个")},
+		{`format(1)`, errorResult("format不支持的参数类型，INTEGER")},
+		{`format()`, errorResult("入参数量不正确，至少需要1个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("入参数量不正确，需要1个，实际%d个", len(args))
+		}
+		num, ok := args[0].(*object.Integer)
+		if !ok {
+			return newError("double不支持的参数类型，%s", args[0].Type())
+		}
+		return &object.Integer{Value: num.Value * 2}
+	}
+	e := New()
+	if err := e.RegisterBuiltin("double", double); err != nil {
+		t.Fatalf("RegisterBuiltin returned error: %s", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`double(21)`, 42},
+		{`map([1, 2, 3], double)`, []int64{2, 4, 6}},
+		{`double("a")`, errorResult("double不支持的参数类型，STRING")},
+		{`let double = fn(x) { x * 3 }; double(2)`, 6},
+	}
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+	// 只注册到这个Evaluator上，其他的评估看不到
+	testErrorObject(t, testEval(`double(21)`), "变量未定义: double")
+
+	err := e.RegisterBuiltin("double", double)
+	if err == nil || err.Error() != "内置函数已存在: double" {
+		t.Errorf("expected clash error for double. got=%v", err)
+	}
+	err = e.RegisterBuiltin("len", double)
+	if err == nil || err.Error() != "内置函数已存在: len" {
+		t.Errorf("expected clash error for len. got=%v", err)
+	}
+	testIntegerObject(t, testEval(`len("abc")`), 3)
+
+	err = e.RegisterBuiltin("nothing", nil)
+	if err == nil || err.Error() != "内置函数不能为nil: nothing" {
+		t.Errorf("expected nil function error. got=%v", err)
+	}
+}
+
+func TestImportBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	writeModule := func(name, source string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatalf("write %s: %s", name, err)
+		}
+		return path
+	}
+	mathPath := writeModule("math.monkey", `let square = fn(x) { x * x }; let pi = 3;`)
+	writeModule("geo.monkey", `let m = import("math.monkey"); let area = fn(r) { m["pi"] * m["square"](r) };`)
+	aPath := writeModule("a.monkey", `let b = import("b.monkey");`)
+	bPath := writeModule("b.monkey", `let a = import("a.monkey");`)
+	badPath := writeModule("bad.monkey", `let = secret;`)
+	writeModule("fail.monkey", `let x = 1 + true;`)
+
+	// 没有开启文件读写时不能导入
+	testErrorObject(t, testEval(fmt.Sprintf(`import(%q)`, mathPath)), "文件读写未开启")
+
+	e := New()
+	e.EnableFileIO = true
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{fmt.Sprintf(`let m = import(%q); m["square"](4)`, mathPath), 16},
+		{fmt.Sprintf(`import(%q)["pi"]`, mathPath), 3},
+		{fmt.Sprintf(`keys(import(%q))`, mathPath), inspected("[pi, square]")},
+		{fmt.Sprintf(`let g = import(%q); g["area"](2)`, filepath.Join(dir, "geo.monkey")), 12},
+		{fmt.Sprintf(`import(%q)`, aPath), errorResult(fmt.Sprintf("循环导入: %s -> %s -> %s", aPath, bPath, aPath))},
+		{fmt.Sprintf(`import(%q)`, filepath.Join(dir, "fail.monkey")), errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{fmt.Sprintf(`import(%q)`, badPath), errorResult(fmt.Sprintf("导入模块 %s 解析失败: 1个语法错误", badPath))},
+		{`import(1)`, errorResult("import不支持的参数类型，INTEGER")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+	if len(e.importing) != 0 {
+		t.Errorf("importing not empty after imports. got=%v", e.importing)
+	}
+}
+
+func TestFunctionDefaultParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b = 10) { a + b }; add(1)`, 11},
+		{`let add = fn(a, b = 10) { a + b }; add(1, 2)`, 3},
+		{`let f = fn(a = 1, b = 2) { a * 10 + b }; f()`, 12},
+		{`let f = fn(a = 1, b = 2) { a * 10 + b }; f(5)`, 52},
+		{`let f = fn(a, b = a * 2) { a + b }; f(3)`, 9},
+		{`let n = 100; let f = fn(a = n) { a }; f()`, 100},
+		{`let calls = 0; let f = fn(a = calls = calls + 1) { a }; f(); f(); f(7); calls`, 2},
+		{`let f = fn(a = 1 + true) { a }; f(5)`, 5},
+		{`let f = fn(a = 1 + true) { a }; f()`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`let f = fn(a = missing) { a }; f()`, errorResult("变量未定义: missing")},
+		{`fn(a, b = 2) { a }`, inspected("fn(a, b = 2) {\na\n}")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestVariadicFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(first, ...rest) { rest }; f(1)`, []int64{}},
+		{`let f = fn(first, ...rest) { rest }; f(1, 2, 3)`, []int64{2, 3}},
+		{`let f = fn(first, ...rest) { first }; f(1, 2, 3)`, 1},
+		{`let count = fn(...args) { len(args) }; count()`, 0},
+		{`let count = fn(...args) { len(args) }; count(1, "a", true)`, 3},
+		{`let total = fn(...nums) { sum(nums) }; total(1, 2, 3, 4)`, 10},
+		{`let f = fn(a, b = 10, ...rest) { [a, b, len(rest)] }; f(1)`, []int64{1, 10, 0}},
+		{`let f = fn(a, b = 10, ...rest) { [a, b, len(rest)] }; f(1, 2, 3, 4)`, []int64{1, 2, 2}},
+		{`let f = fn(a, b, ...rest) { a }; f(1)`, errorResult("参数数量不匹配: 期望至少2个, 实际1个")},
+		{`fn(a, ...rest) { a }`, inspected("fn(a, ...rest) {\na\n}")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b) { a + b }; add(1)`, errorResult("参数数量不匹配: 期望2个, 实际1个")},
+		{`let add = fn(a, b) { a + b }; add(1, 2, 3)`, errorResult("参数数量不匹配: 期望2个, 实际3个")},
+		{`let add = fn(a, b) { a + b }; add()`, errorResult("参数数量不匹配: 期望2个, 实际0个")},
+		{`fn() { 1 }(1)`, errorResult("参数数量不匹配: 期望0个, 实际1个")},
+		{`let f = fn(a, b = 1) { a + b }; f()`, errorResult("参数数量不匹配: 期望1到2个, 实际0个")},
+		{`let f = fn(a, b = 1) { a + b }; f(1, 2, 3)`, errorResult("参数数量不匹配: 期望1到2个, 实际3个")},
+		{`let f = fn(a, ...rest) { a }; f()`, errorResult("参数数量不匹配: 期望至少1个, 实际0个")},
+		{`map([1, 2], fn(a, b) { a })`, errorResult("参数数量不匹配: 期望2个, 实际1个")},
+		{`let add = fn(a, b) { a + b }; add(1, 2)`, 3},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 报错的位置是调用处
+	evaluated := testEval("let add = fn(a, b) { a + b };\nadd(1);")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Line != 2 {
+		t.Errorf("error line wrong. want=2, got=%d", errObj.Line)
+	}
+}
+
+func TestTernaryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = 3; let b = 5; let x = a > b ? a : b; x`, 5},
+		{`true ? 1 : 2`, 1},
+		{`false ? 1 : 2`, 2},
+		{`null ? 1 : 2`, 2},
+		{`0 ? "yes" : "no"`, "yes"},
+		{`let n = 0; n < 0 ? "neg" : n == 0 ? "zero" : "pos"`, "zero"},
+		// 未被选中的分支不会被评估
+		{`true ? 1 : missing`, 1},
+		{`false ? 1 + true : 2`, 2},
+		{`let n = 0; true ? n = 1 : (n = 2); n`, 1},
+		{`let n = 0; false ? n = 1 : (n = 2); n`, 2},
+		{`missing ? 1 : 2`, errorResult("变量未定义: missing")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestAssertBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`assert(true)`, nil},
+		{`assert(1 + 1 == 2, "math works")`, nil},
+		{`assert(0)`, nil},
+		{`assert(false)`, errorResult("断言失败")},
+		{`assert(null)`, errorResult("断言失败")},
+		{`assert(1 > 2, "1 should be greater")`, errorResult("断言失败: 1 should be greater")},
+		{`assert(false, "stop"); 10`, errorResult("断言失败: stop")},
+		{`assert(true, 1)`, errorResult("assert不支持的参数类型，INTEGER")},
+		{`assert()`, errorResult("入参数量不正确，需要1到2个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFloatExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`3.14`, 3.14},
+		{`1_000.5`, 1000.5},
+		{`1.5 + 1.5`, 3.0},
+		{`1 + 0.5`, 1.5},
+		{`0.5 * 4`, 2.0},
+		{`7 / 2.0`, 3.5},
+		{`1.0 - 2.5`, -1.5},
+		{`1.5 < 2`, true},
+		{`2 >= 2.0`, true},
+		{`1 == 1.0`, true},
+		{`0.1 + 0.2 == 0.3`, false},
+		{`1.0 / 0`, errorResult("除以零")},
+		{`1.5 + "a"`, errorResult("类型不匹配: FLOAT + STRING")},
+		{`type(1.0)`, "FLOAT"},
+		{`3.0`, inspected("3.0")},
+		{`0.1 + 0.2`, inspected("0.30000000000000004")},
+		{`str(2.50)`, "2.5"},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRoundingBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`floor(3.7)`, 3},
+		{`ceil(3.2)`, 4},
+		{`round(3.5)`, 4},
+		{`round(3.4)`, 3},
+		{`floor(0 - 3.2)`, -4},
+		{`ceil(0 - 3.7)`, -3},
+		{`round(0 - 3.5)`, -4},
+		{`round(2.5)`, 3},
+		{`round(0.0)`, 0},
+		{`floor(5)`, 5},
+		{`ceil(0 - 5)`, -5},
+		{`round(5)`, 5},
+		{`floor(10000000000000000000.0)`, errorResult("floor结果超出整数范围: 1e+19")},
+		{`floor("3.7")`, errorResult("floor不支持的参数类型，STRING")},
+		{`round()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSqrtAndPowBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`pow(2, 10)`, 1024},
+		{`pow(3, 0)`, 1},
+		{`pow(0 - 2, 3)`, -8},
+		{`pow(2, 62)`, 4611686018427387904},
+		{`pow(2, 64)`, 18446744073709551616.0},
+		{`pow(2, 0 - 1)`, 0.5},
+		{`pow(4, 0.5)`, 2.0},
+		{`pow(1.5, 2)`, 2.25},
+		{`sqrt(9)`, 3.0},
+		{`sqrt(2.25)`, 1.5},
+		{`sqrt(0)`, 0.0},
+		{`sqrt(0 - 1)`, errorResult("sqrt的参数不能为负数: -1")},
+		{`sqrt("9")`, errorResult("sqrt不支持的参数类型，STRING")},
+		{`pow(2, "3")`, errorResult("pow不支持的参数类型，STRING")},
+		{`pow(2)`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestRandomBuiltin(t *testing.T) {
+	e := New()
+	sequence := `seed(42); [random(100), random(100), random(10, 20), random(0 - 5, 5)]`
+	first := testEvalWith(e, sequence)
+	second := testEvalWith(e, sequence)
+	if first.Inspect() != second.Inspect() {
+		t.Errorf("seeded sequence not reproducible. first=%s, second=%s", first.Inspect(), second.Inspect())
+	}
+
+	e.Rand = rand.New(rand.NewSource(7))
+	third := testEvalWith(e, `[random(100), random(100), random(10, 20), random(0 - 5, 5)]`)
+	if testEvalWith(e, `seed(7)`) != NULL {
+		t.Errorf("seed should return NULL")
+	}
+	fourth := testEvalWith(e, `[random(100), random(100), random(10, 20), random(0 - 5, 5)]`)
+	if third.Inspect() != fourth.Inspect() {
+		t.Errorf("seed() and Rand disagree. Rand=%s, seed=%s", third.Inspect(), fourth.Inspect())
+	}
+
+	testEvalWith(e, `seed(1)`)
+	for i := 0; i < 100; i++ {
+		n := testEvalWith(e, `random(3, 6)`).(*object.Integer).Value
+		if n < 3 || n >= 6 {
+			t.Fatalf("random(3, 6) out of range. got=%d", n)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`random(1)`, 0},
+		{`random(5, 6)`, 5},
+		{`random(0)`, errorResult("random的范围为空: [0, 0)")},
+		{`random(5, 5)`, errorResult("random的范围为空: [5, 5)")},
+		{`random(6, 5)`, errorResult("random的范围为空: [6, 5)")},
+		{`random(0 - 9223372036854775807, 9223372036854775807)`, errorResult("random的范围过大: [-9223372036854775807, 9223372036854775807)")},
+		{`random("1")`, errorResult("random不支持的参数类型，STRING")},
+		{`seed("1")`, errorResult("seed不支持的参数类型，STRING")},
+		{`random()`, errorResult("入参数量不正确，需要1到2个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+}
+
+func TestChrAndOrdBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`ord("A")`, 65},
+		{`ord("λ")`, 955},
+		{`ord("你")`, 20320},
+		{`chr(65)`, "A"},
+		{`chr(955)`, "λ"},
+		{`chr(ord("z"))`, "z"},
+		{`ord("")`, errorResult("ord需要恰好一个字符，实际0个")},
+		{`ord("ab")`, errorResult("ord需要恰好一个字符，实际2个")},
+		{`ord(65)`, errorResult("ord不支持的参数类型，INTEGER")},
+		{`chr(0 - 1)`, errorResult("无效的码点: -1")},
+		{`chr(1114112)`, errorResult("无效的码点: 1114112")},
+		{`chr(55296)`, errorResult("无效的码点: 55296")},
+		{`chr("A")`, errorResult("chr不支持的参数类型，STRING")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMinusPrefixOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`-5`, -5},
+		{`-(-5)`, 5},
+		{`-3.14`, -3.14},
+		{`-(1.5 + 1)`, -2.5},
+		{`- -2.0`, 2.0},
+		{`floor(-3.2)`, -4},
+		{`-"abc"`, errorResult("未知的操作: -STRING")},
+		{`-true`, errorResult("未知的操作: -BOOLEAN")},
+		{`-[1]`, errorResult("未知的操作: -ARRAY")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 操作数没有值时返回错误而不是空指针
+	testErrorObject(t, evalPrefixExpression("-", nil), "缺少操作数: -")
+	testErrorObject(t, evalPrefixExpression("!", nil), "缺少操作数: !")
+}
+
+func TestEntriesBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`entries({"b": 2, "a": 1, "c": [3]})`, inspected(`[[a, 1], [b, 2], [c, [3]]]`)},
+		{`entries({2: "two", 1: "one"})`, inspected(`[[1, one], [2, two]]`)},
+		{`entries({})`, inspected(`[]`)},
+		{`let e = entries({"x": 10}); e[0][1]`, 10},
+		{`entries([1])`, errorResult("entries不支持的参数类型，ARRAY")},
+		{`entries()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestHashLiteralComputedKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"a" + "b": 1, 1 + 1: 2}; h["ab"]`, 1},
+		{`let h = {"a" + "b": 1, 1 + 1: 2}; h[2]`, 2},
+		{`let k = "key"; let h = {k: "v"}; h["key"]`, "v"},
+		{`let f = fn(x) { x * 10 }; let h = {f(2): "twenty"}; h[20]`, "twenty"},
+		{`let h = {1 > 0: "yes"}; h[true]`, "yes"},
+		{`len({"a" + "b": 1, "ab": 2})`, 1},
+		{`{[1]: 1}`, errorResult("无法作为哈希的键, ARRAY")},
+		{`{missing: 1}`, errorResult("变量未定义: missing")},
+	}
+
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestCloneBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clone(1)`, 1},
+		{`clone("a")`, "a"},
+		{`clone([1, [2, 3]])[1][1]`, 3},
+		{`clone({"a": [1, 2]})["a"][0]`, 1},
+		{`let f = fn(x) { x * 2 }; clone(f)(4)`, 8},
+		{`clone()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 还不支持下标赋值，直接检查嵌套的数组和哈希都是新的对象
+	original := testEval(`let a = [1, [2, 3], {"k": [4]}]; a`).(*object.Array)
+	env := object.NewEnvironment()
+	env.Set("a", original)
+	program := parser.New(lexer.New(`clone(a)`)).ParseProgram()
+	cloned, ok := Eval(program, env).(*object.Array)
+	if !ok {
+		t.Fatalf("clone did not return an array")
+	}
+	if cloned == original {
+		t.Errorf("outer array was not copied")
+	}
+	if cloned.Elements[1] == original.Elements[1] {
+		t.Errorf("nested array was not copied")
+	}
+	if cloned.Elements[2] == original.Elements[2] {
+		t.Errorf("nested hash was not copied")
+	}
+	if cloned.Inspect() != original.Inspect() {
+		t.Errorf("clone changed contents. got=%s, want=%s", cloned.Inspect(), original.Inspect())
+	}
+	// 修改复制出来的嵌套数组不影响原来的
+	cloned.Elements[1].(*object.Array).Elements[0] = &object.Integer{Value: 99}
+	if got := original.Elements[1].Inspect(); got != "[2, 3]" {
+		t.Errorf("original nested array was modified. got=%s", got)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"256 >> 4", 16},
+		{"1 << 64", 0},
+		{"1 | 2 & 3", 3},
+		{"(1 | 2) & 3", 3},
+		{"4 | 1 ^ 1", 4},
+		{"1 << 2 + 1", 5},
+		{"(6 & 1) == 0", true},
+		{"1 << -1", errorResult("移位次数不能为负数: -1")},
+		{"8 >> -2", errorResult("移位次数不能为负数: -2")},
+		{"true & false", errorResult("未知的操作: BOOLEAN & BOOLEAN")},
+		{"1.5 | 1", errorResult("未知的操作: FLOAT | INTEGER")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBitwiseNotOperator(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"~0", -1},
+		{"~5", -6},
+		{"~-1", 0},
+		{"~~7", 7},
+		{"~5 & 0xff", 250},
+		{`~"abc"`, errorResult("未知的操作: ~STRING")},
+		{"~1.5", errorResult("未知的操作: ~FLOAT")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"fn() { if (true) { return; } 5 }()", nil},
+		{"fn() { if (false) { return; } 5 }()", 5},
+		{"let f = fn(x) { if (x > 0) { return } x }; f(1)", nil},
+		{"return; 10", nil},
+		{"let i = 0; fn() { while (true) { i = i + 1; if (i == 3) { return; } } }(); i", 3},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestExitBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"exit()", inspected("exit(0)")},
+		{"exit(2); 10", inspected("exit(2)")},
+		{"let i = 0; while (true) { i = i + 1; if (i == 3) { exit(i) } }; 10", inspected("exit(3)")},
+		{"map([1, 2, 3], fn(x) { if (x == 2) { exit(1) } x })", inspected("exit(1)")},
+		{"fn() { return exit(4); }(); 5", inspected("exit(4)")},
+		{`exit("1")`, errorResult("exit不支持的参数类型，STRING")},
+		{"exit(1, 2)", errorResult("入参数量不正确，需要0到1个，实际2个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// exit之后的语句不会执行
+	_, output := captureOutput(`puts(1); if (true) { exit(0); puts(2) }; puts(3)`)
+	if output != "1\n" {
+		t.Errorf("statements after exit were evaluated. output=%q", output)
+	}
+}
+
+func TestMemberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let user = {"name": "monkey", "age": 3}; user.name`, "monkey"},
+		{`let user = {"name": "monkey", "age": 3}; user.age + 1`, 4},
+		{`let user = {"name": "monkey"}; user.email`, nil},
+		{`let h = {"inner": {"list": [1, 2, 3]}}; h.inner.list[2]`, 3},
+		{`let h = {"add": fn(a, b) { a + b }}; h.add(1, 2)`, 3},
+		{`{1: "one"}.one`, nil},
+		{`[1, 2].length`, errorResult("不支持访问成员, ARRAY.length")},
+		{`let s = "abc"; s.len`, errorResult("不支持访问成员, STRING.len")},
+		{`let h = {"a": 1}; h.a.b`, errorResult("不支持访问成员, INTEGER.b")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPostfixExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; i++; i", 1},
+		// 在增加++和--之前就合法的写法，结果保持不变
+		{"5--3", 8},
+		{"--5", 5},
+		{"let x = 4; x--1", 5},
+		{"let x = 4; x--1; x", 4},
+		{"let i = 0; i++", 0},
+		{"let i = 5; i--; i--; i", 3},
+		{"let i = 5; let j = i--; j * 10 + i", 54},
+		{"let i = 0; while (i < 10) { i++ }; i", 10},
+		{"let i = 0; let inc = fn() { i++ }; inc(); inc(); i", 2},
+		{"i++", errorResult("变量未定义: i")},
+		{`let s = "a"; s++`, errorResult("未知的操作: STRING++")},
+		{"let f = 1.5; f--", errorResult("未知的操作: FLOAT--")},
+		{"const c = 1; c++", errorResult("无法重新赋值常量: c")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{`let h = {"b": 2, "a": 1, "c": 3}; let s = ""; for (k in h) { s = s + k }; s`, "abc"},
+		{`let h = {"b": 2, "a": 1}; let total = 0; for (k in h) { total = total + h[k] }; total`, 3},
+		{"let n = 0; for (x in []) { n++ }; n", 0},
+		{"for (x in [1]) { x }", 1},
+		{"let x = 10; for (x in [1, 2]) { let y = x }; x", 10},
+		{"for (x in [1, 2]) { let y = x }; y", errorResult("变量未定义: y")},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } }; 0 }; f()", 20},
+		{"let a = [1, 2]; let n = 0; for (x in a) { a = push(a, x); n++ }; n", 2},
+		{"for (x in [1, 2]) { x + true }", errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{"for (x in 5) {}", errorResult("无法遍历: INTEGER")},
+		{`for (c in "abc") {}`, errorResult("无法遍历: STRING")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 循环体里的defer在每次迭代结束时执行
+	_, output := captureOutput(`for (x in [1, 2]) { defer puts(x * 10); puts(x) }`)
+	if output != "1\n10\n2\n20\n" {
+		t.Errorf("deferred output wrong. got=%q", output)
+	}
+}
+
+func TestZipBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`zip([1, 2, 3], ["a", "b", "c"])`, inspected(`[[1, a], [2, b], [3, c]]`)},
+		{`zip([1, 2, 3], ["a"])`, inspected(`[[1, a]]`)},
+		{`zip([], [1, 2])`, inspected(`[]`)},
+		{`zip([1, 2], [true, false], [[3], [4]])`, inspected(`[[1, true, [3]], [2, false, [4]]]`)},
+		{`let sum = 0; for (p in zip([1, 2], [10, 20])) { sum = sum + p[0] * p[1] }; sum`, 50},
+		{`zip([1], 2)`, errorResult("zip不支持的参数类型，INTEGER")},
+		{`zip("ab", [1])`, errorResult("zip不支持的参数类型，STRING")},
+		{`zip([1])`, errorResult("入参数量不正确，至少需要2个，实际1个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestStartsWithAndEndsWithBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`starts_with("hello", "he")`, true},
+		{`starts_with("hello", "lo")`, false},
+		{`starts_with("hello", "")`, true},
+		{`starts_with("", "a")`, false},
+		{`ends_with("hello", "lo")`, true},
+		{`ends_with("hello", "he")`, false},
+		{`ends_with("hello", "")`, true},
+		{`ends_with("你好世界", "世界")`, true},
+		{`starts_with(1, "a")`, errorResult("starts_with不支持的参数类型，INTEGER")},
+		{`ends_with("a", ["a"])`, errorResult("ends_with不支持的参数类型，ARRAY")},
+		{`starts_with("a")`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestEnvironmentCloneClosures(t *testing.T) {
+	setup := `let count = 0; let inc = fn() { count = count + 1; count };`
+	base := object.NewEnvironment()
+	Eval(parser.New(lexer.New(setup)).ParseProgram(), base)
+
+	// 每个副本都从同一组变量开始，闭包修改的是副本自己的变量
+	program := parser.New(lexer.New(`inc(); inc()`)).ParseProgram()
+	for i := 0; i < 3; i++ {
+		testIntegerObject(t, Eval(program, base.Clone()), 2)
+	}
+	count, _ := base.Get("count")
+	testIntegerObject(t, count, 0)
+}
+
+func TestMixedNumericComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 == 1.0", true},
+		{"1.0 == 1", true},
+		{"1 != 1.0", false},
+		{"2 == 2.5", false},
+		{"2 != 2.5", true},
+		{"1 < 1.5", true},
+		{"2.5 > 2", true},
+		{"3 <= 3.0", true},
+		{"-1 >= -0.5", false},
+		{"[1, 2] == [1.0, 2.0]", true},
+		{`{"a": 1} == {"a": 1.0}`, true},
+		{`[1, [2]] == [1.0, [2.5]]`, false},
+		{`1 == "1"`, false},
+		{`1 != "1"`, true},
+		{`1.0 == "1.0"`, false},
+		{`[1] == ["1"]`, false},
+		{`1 < "1"`, errorResult("类型不匹配: INTEGER < STRING")},
+		{`1.5 > "1"`, errorResult("类型不匹配: FLOAT > STRING")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestUniqueBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`unique([1, 2, 2, 3, 1])`, []int64{1, 2, 3}},
+		{`unique([3, 1, 3, 2, 1])`, []int64{3, 1, 2}},
+		{`unique(["b", "a", "b", "c", "a"])`, inspected(`[b, a, c]`)},
+		{`unique([1, 2, 3])`, []int64{1, 2, 3}},
+		{`unique([])`, []int64{}},
+		{`unique([true, false, true, null, null])`, inspected(`[true, false, null]`)},
+		{`unique([1, "1", true])`, inspected(`[1, 1, true]`)},
+		{`unique([1.5, 1.5, 2.5])`, inspected(`[1.5, 2.5]`)},
+		{`unique([1, 1.0, 2.0, 2])`, inspected(`[1, 2.0]`)},
+		{`unique([0.1 + 0.2, 0.3])`, inspected(`[0.30000000000000004, 0.3]`)},
+		// 数组、哈希这类不能作为键的值按对象本身去重
+		{`let a = [1]; unique([a, a, [1]])`, inspected(`[[1], [1]]`)},
+		{`unique(1)`, errorResult("unique不支持的参数类型，INTEGER")},
+		{`unique()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestGroupByBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let g = group_by([1, 2, 3, 4], fn(x) { x - x / 2 * 2 }); g[0]`, []int64{2, 4}},
+		{`let g = group_by([1, 2, 3, 4], fn(x) { x - x / 2 * 2 }); g[1]`, []int64{1, 3}},
+		{`len(group_by([1, 2, 3, 4], fn(x) { x > 2 }))`, 2},
+		{`group_by(["apple", "avocado", "banana"], fn(s) { s[0] })["a"]`, inspected(`[apple, avocado]`)},
+		{`group_by([], fn(x) { x })`, inspected(`{}`)},
+		{`group_by([1, 2], fn(x) { [x] })`, errorResult("无法作为哈希的键, ARRAY")},
+		{`group_by([1, 2], fn(x) { x + true })`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`group_by([1], fn(x, y) { x })`, errorResult("参数数量不匹配: 期望2个, 实际1个")},
+		{`group_by(1, fn(x) { x })`, errorResult("group_by不支持的参数类型，INTEGER")},
+		{`group_by([1], 1)`, errorResult("group_by不支持的参数类型，INTEGER")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+// 锁定块、if、循环和函数体的取值规则，修改求值逻辑时不应该悄悄改变这些结果
+func TestBlockValueSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 循环的值是最后一次执行循环体的值，一次都没执行时是null
+		{"let i = 0; while (i < 3) { i = i + 1; i * 10 }", 30},
+		{"let i = 0; while (i < 0) { i = i + 1 }", nil},
+		{"let i = 0; while (i < 2) { i++; let x = i }", nil},
+		{"let i = 0; let r = while (i < 3) { i++ }; r", 2},
+		{"let i = 0; while (i < 5) { i++; if (i > 3) { i * 100 } }", 500},
+		{"let i = 0; while (i < 4) { i++; if (i < 3) { i } }", nil},
+		{"for (x in [1, 2, 3]) { x * 2 }", 6},
+		{"for (x in []) { x }", nil},
+		{`for (k in {"b": 1, "a": 2}) { k }`, "b"},
+		{"fn() { for (x in [1, 2]) { x } }()", 2},
+		// if、else的值是被执行分支的最后一条语句
+		{"if (true) { 1; 2; 3 }", 3},
+		{"if (false) { 1 } else { 2; 4 }", 4},
+		{"if (false) { 1 }", nil},
+		{"if (true) {}", nil},
+		{"if (true) { let x = 1 }", nil},
+		{"if (true) { if (false) { 1 } else { 2 } }", 2},
+		{"let v = if (1 > 2) { 10 } else { 20 }; v + 1", 21},
+		// 函数体的值是最后一条语句，return提前结束
+		{"fn() { 1; 2 }()", 2},
+		{"fn() {}()", nil},
+		{"fn() { let x = 5 }()", nil},
+		{"fn() { let x = 5; x }()", 5},
+		{"fn(x) { if (x) { 1 } else { 2 } }(false)", 2},
+		{"fn() { return 1; 2 }()", 1},
+		{"fn() { if (true) { return 1 } 2 }()", 1},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTypePredicateBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`is_null(null)`, true},
+		{`is_null(fn() {}())`, true},
+		{`is_null(0)`, false},
+		{`is_array([1])`, true},
+		{`is_array({})`, false},
+		{`is_string("a")`, true},
+		{`is_string(1)`, false},
+		{`is_int(1)`, true},
+		{`is_int(1.0)`, false},
+		{`is_int("1")`, false},
+		{`is_fn(fn(x) { x })`, true},
+		{`is_fn(len)`, true},
+		{`is_fn("len")`, false},
+		{`is_error(1)`, false},
+		{`is_error(null)`, false},
+		// is_error的参数出错时不中断评估
+		{`is_error(1 + true)`, true},
+		{`is_error(missing)`, true},
+		{`let r = is_error(10 / 0); r ? "failed" : "ok"`, "failed"},
+		{`let f = fn(x) { is_error(10 / x) }; [f(0), f(5)]`, inspected("[true, false]")},
+		{`let safe = fn(x) { if (is_error(10 / x)) { 0 } else { 10 / x } }; safe(0) + safe(2)`, 5},
+		{`is_error(1 + true, 2)`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`is_error(1, 2)`, errorResult("入参数量不正确，需要1个，实际2个")},
+		{`let is_error = fn(x) { 7 }; is_error(1 + true)`, errorResult("类型不匹配: INTEGER + BOOLEAN")},
+		{`is_int()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// exit不是错误，仍然结束评估
+	evaluated := testEval(`is_error(exit(2)); 1`)
+	if exit, ok := evaluated.(*object.Exit); !ok || exit.Code != 2 {
+		t.Errorf("exit inside is_error did not stop evaluation. got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestParseIntBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`parse_int("ff", 16)`, 255},
+		{`parse_int("FF", 16)`, 255},
+		{`parse_int("101", 2)`, 5},
+		{`parse_int("-777", 8)`, -511},
+		{`parse_int("z", 36)`, 35},
+		{`parse_int("42", 10)`, 42},
+		{`parse_int("7fffffffffffffff", 16)`, 9223372036854775807},
+		{`parse_int("ff", 1)`, errorResult("进制必须在2到36之间，实际是1")},
+		{`parse_int("ff", 37)`, errorResult("进制必须在2到36之间，实际是37")},
+		{`parse_int("102", 2)`, errorResult(`无法将 "102" 按2进制转换为整数`)},
+		{`parse_int("0xff", 16)`, errorResult(`无法将 "0xff" 按16进制转换为整数`)},
+		{`parse_int("8000000000000000", 16)`, errorResult(`整数超出范围: "8000000000000000"`)},
+		{`parse_int("", 10)`, errorResult("parse_int的字符串不能为空")},
+		{`parse_int(10, 10)`, errorResult("parse_int不支持的参数类型，INTEGER")},
+		{`parse_int("10", "2")`, errorResult("parse_int不支持的参数类型，STRING")},
+		{`parse_int("10")`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestToJSONBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`to_json(1)`, "1"},
+		{`to_json(-2.5)`, "-2.5"},
+		{`to_json("a<b>&c")`, `"a<b>&c"`},
+		{`to_json(true)`, "true"},
+		{`to_json(null)`, "null"},
+		{`to_json([])`, "[]"},
+		{`to_json({})`, "{}"},
+		{`to_json({"name": "monkey", "tags": ["a", "b"], "meta": {"age": 3, "ok": true, "none": null}})`,
+			`{"meta":{"age":3,"none":null,"ok":true},"name":"monkey","tags":["a","b"]}`},
+		{`to_json([1, [2, {"x": [3]}]])`, `[1,[2,{"x":[3]}]]`},
+		{`to_json({1: "one", true: "yes"})`, `{"1":"one","true":"yes"}`},
+		{`to_json({1: "a", "1": "b"})`, errorResult("to_json的键转换成字符串后重复: 1")},
+		{`to_json(fn(x) { x })`, errorResult("to_json不支持的参数类型，FUNCTION")},
+		{`to_json({"f": [len]})`, errorResult("to_json不支持的参数类型，BUILTIN")},
+		{`to_json()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 脚本里算不出NaN，宿主程序注入的值可能是
+	testErrorObject(t, builtins["to_json"].Fn(&object.Float{Value: math.NaN()}), "to_json无法表示的小数: NaN")
+}
+
+func TestFromJSONBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`from_json("42")`, 42},
+		{`from_json("-7")`, -7},
+		{`from_json("2.5")`, 2.5},
+		{`from_json("1.0")`, 1.0},
+		{`from_json("1e3")`, 1000.0},
+		{`from_json("9223372036854775807")`, 9223372036854775807},
+		{`from_json("true")`, true},
+		{`from_json("false")`, false},
+		{`from_json("null")`, nil},
+		{`from_json(" [1, 2, 3] ")`, []int64{1, 2, 3}},
+		{`from_json("{}")`, inspected("{}")},
+		{`let h = from_json("{'a': 1}"); h`, errorResult("from_json解析失败: invalid character '\\'' looking for beginning of object key string")},
+		{`from_json("[1, 2")`, errorResult("from_json解析失败: unexpected EOF")},
+		{`from_json("")`, errorResult("from_json解析失败: EOF")},
+		{`from_json("1 2")`, errorResult("from_json解析失败: JSON后面有多余的内容")},
+		{`from_json("9223372036854775808")`, errorResult("from_json整数超出范围: 9223372036854775808")},
+		{`from_json("[1, 99999999999999999999]")`, errorResult("from_json整数超出范围: 99999999999999999999")},
+		{`from_json(1)`, errorResult("from_json不支持的参数类型，INTEGER")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 字符串字面量里写不了双引号，JSON文本从环境里注入
+	docTests := []struct {
+		doc      string
+		input    string
+		expected interface{}
+	}{
+		{`"monkey"`, `from_json(doc)`, "monkey"},
+		{`{"name": "monkey", "tags": ["a", "b"]}`, `from_json(doc)["tags"][1]`, "b"},
+		{`{"meta": {"age": 3, "scores": [1.5, 2]}}`, `from_json(doc)["meta"]["scores"]`, inspected("[1.5, 2]")},
+		{`{"a": null, "b": true}`, `let h = from_json(doc); [h["a"], h["b"], len(h)]`, inspected("[null, true, 2]")},
+		{`[{"x": 1}, {"x": 2}]`, `map(from_json(doc), fn(h) { h.x })`, []int64{1, 2}},
+		{`{"k": [1, {"v": "s"}]}`, `to_json(from_json(doc))`, `{"k":[1,{"v":"s"}]}`},
+		{`{"a": 1,}`, `from_json(doc)`, errorResult("from_json解析失败: invalid character '}' looking for beginning of object key string")},
+	}
+	for _, tt := range docTests {
+		env := object.NewEnvironment()
+		env.Set("doc", &object.String{Value: tt.doc})
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		testObject(t, Eval(program, env), tt.expected)
+	}
+}
+
+func TestNowBuiltin(t *testing.T) {
+	e := New()
+	e.Now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC) }
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`now()`, 1704164645},
+		{`now("s")`, 1704164645},
+		{`now("ms")`, 1704164645678},
+		{`now("ms") - now() * 1000`, 678},
+		{`now("us")`, errorResult("now不支持的时间单位: us")},
+		{`now(1)`, errorResult("now不支持的参数类型，INTEGER")},
+		{`now("s", "ms")`, errorResult("入参数量不正确，需要0到1个，实际2个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEvalWith(e, tt.input), tt.expected)
+	}
+}
+
+func TestSleepBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`sleep(0)`, nil},
+		{`sleep(1); 5`, 5},
+		{`sleep(-1)`, errorResult("sleep的时间不能为负数: -1")},
+		{`sleep(9223372036854775807)`, errorResult("sleep的时间过长: 9223372036854775807")},
+		{`sleep("1")`, errorResult("sleep不支持的参数类型，STRING")},
+		{`sleep()`, errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// context超时后sleep立即返回，不会睡满10秒
+	program := parser.New(lexer.New(`sleep(10000); 1`)).ParseProgram()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("sleep ignored cancellation. elapsed=%s", elapsed)
+	}
+	testErrorObject(t, evaluated, "执行已取消: context deadline exceeded")
+}
+
+func TestRemoveBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`remove([10, 20, 30], 0)`, []int64{20, 30}},
+		{`remove([10, 20, 30], 1)`, []int64{10, 30}},
+		{`remove([10, 20, 30], 2)`, []int64{10, 20}},
+		{`remove([10], 0)`, []int64{}},
+		{`let a = [1, 2, 3]; let b = remove(a, 1); a`, []int64{1, 2, 3}},
+		{`remove([], 0)`, errorResult("remove的下标越界: 0，数组长度为0")},
+		{`remove([10, 20, 30], 3)`, errorResult("remove的下标越界: 3，数组长度为3")},
+		{`remove([10, 20, 30], -1)`, errorResult("remove的下标越界: -1，数组长度为3")},
+		{`remove("abc", 1)`, errorResult("remove不支持的参数类型，STRING")},
+		{`remove([1], "0")`, errorResult("remove不支持的参数类型，STRING")},
+		{`remove([1])`, errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestInsertBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`insert([2, 3], 0, 1)`, []int64{1, 2, 3}},
+		{`insert([1, 3], 1, 2)`, []int64{1, 2, 3}},
+		{`insert([1, 2], 2, 3)`, []int64{1, 2, 3}},
+		{`insert([], 0, 1)`, []int64{1}},
+		{`insert([1], 1, [2])`, inspected("[1, [2]]")},
+		{`let a = [1, 3]; let b = insert(a, 1, 2); a`, []int64{1, 3}},
+		{`insert([1, 2], 3, 0)`, errorResult("insert的下标越界: 3，数组长度为2")},
+		{`insert([1, 2], -1, 0)`, errorResult("insert的下标越界: -1，数组长度为2")},
+		{`insert({}, 0, 1)`, errorResult("insert不支持的参数类型，HASH")},
+		{`insert([1], true, 1)`, errorResult("insert不支持的参数类型，BOOLEAN")},
+		{`insert([1], 0)`, errorResult("入参数量不正确，需要3个，实际2个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestComparisonChain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 < 2 < 3", true},
+		{"3 < 2 < 1", false},
+		{"1 < 3 < 2", false},
+		{"1 <= 1 < 2 >= 2", true},
+		{"3 > 2 > 1", true},
+		{"1.5 < 2 < 2.5", true},
+		{`"a" < "b" < "c"`, true},
+		{"if (0 < 5 < 10) { 1 } else { 2 }", 1},
+		// 中间的运算数只求值一次，不成立后不再求值后面的运算数
+		{"let n = 0; let f = fn() { n = n + 1; 2 }; 1 < f() < 3; n", 1},
+		{"let n = 0; let f = fn() { n = n + 1; 2 }; 3 < 1 < f(); n", 0},
+		{"(1 < 2) < 3", errorResult("类型不匹配: BOOLEAN < INTEGER")},
+		{"1 < true < 3", errorResult("类型不匹配: INTEGER < BOOLEAN")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestApplyBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"apply(fn(a, b) { a - b }, [5, 3])", 2},
+		{"apply(fn() { 1 }, [])", 1},
+		{"apply(fn(first, ...rest) { len(rest) }, [1, 2, 3])", 2},
+		{"apply(fn(a, b = 10) { a + b }, [1])", 11},
+		{"apply(len, [[1, 2, 3]])", 3},
+		{"let args = [1, 2]; apply(fn(...xs) { push(xs, 3) }, args); args", []int64{1, 2}},
+		{"apply(fn(a, b) { a + b }, [1])", errorResult("参数数量不匹配: 期望2个, 实际1个")},
+		{"apply(fn(a, b) { a + b }, [1, 2, 3])", errorResult("参数数量不匹配: 期望2个, 实际3个")},
+		{"apply(1, [1])", errorResult("apply不支持的参数类型，INTEGER")},
+		{"apply(len, \"abc\")", errorResult("apply不支持的参数类型，STRING")},
+		{"apply(len)", errorResult("入参数量不正确，需要2个，实际1个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestPartialBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b) { a + b }; let addFive = partial(add, 5); addFive(3)", 8},
+		{"let sub = fn(a, b) { a - b }; partial(sub, 10)(3)", 7},
+		{"let f = fn(a, b, c) { a * 100 + b * 10 + c }; partial(f, 1, 2)(3)", 123},
+		{"let f = fn(a, b, c) { a * 100 + b * 10 + c }; partial(partial(f, 1), 2)(3)", 123},
+		{"partial(fn(a, b) { a + b })(1, 2)", 3},
+		{"partial(len, [1, 2])()", 2},
+		{"let add = partial(fn(a, b) { a + b }, 1); map([1, 2], add)", []int64{2, 3}},
+		{"let addFive = partial(fn(a, b) { a + b }, 5); addFive(1); addFive(2)", 7},
+		{"partial(fn(a, b) { a + b }, 1)(2, 3)", errorResult("参数数量不匹配: 期望2个, 实际3个")},
+		{"partial(1, 2)", errorResult("partial不支持的参数类型，INTEGER")},
+		{"partial()", errorResult("入参数量不正确，至少需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestComposeBuiltin(t *testing.T) {
+	prelude := "let double = fn(x) { x * 2 }; let inc = fn(x) { x + 1 }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 从右到左调用：先inc再double
+		{prelude + "compose(double, inc)(5)", 12},
+		{prelude + "compose(inc, double)(5)", 11},
+		{prelude + "compose(inc, double, inc)(5)", 13},
+		{prelude + "compose(inc)(5)", 6},
+		{prelude + "compose(double, fn(a, b) { a + b })(1, 2)", 6},
+		{prelude + "compose(len, rest)([1, 2, 3])", 2},
+		{prelude + "map([1, 2], compose(double, inc))", []int64{4, 6}},
+		{prelude + "let calls = []; let f = fn(x) { calls = push(calls, x); x }; compose(double, f, inc)(1); calls", []int64{2}},
+		{prelude + "compose(inc, fn(x) { x / 0 })(1)", errorResult("除以零")},
+		{prelude + "compose(double, inc)(true)", errorResult("类型不匹配: BOOLEAN + INTEGER")},
+		{prelude + "compose(inc, 1)", errorResult("compose不支持的参数类型，INTEGER")},
+		{"compose()", errorResult("入参数量不正确，至少需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// 远超调用层数限制，尾递归不占用调用栈
+		{"let sum = fn(n, acc) { if (n == 0) { acc } else { sum(n - 1, acc + n) } }; sum(100000, 0)", 5000050000},
+		{"let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)", 5000050000},
+		{"let sum = fn(n, acc) { n == 0 ? acc : sum(n - 1, acc + n) }; sum(100000, 0)", 5000050000},
+		{"let count = fn(n, acc = 0) { if (n > 0) { let m = n - 1; count(m, acc + 1) } else { acc } }; count(5000)", 5000},
+		{"let last = fn(first, ...rest) { if (len(rest) == 0) { first } else { apply(last, rest) } }; last(1, 2, 3)", 3},
+		// 不在尾部位置的递归仍然受调用层数限制
+		{"let f = fn(n) { if (n == 0) { 0 } else { let r = f(n - 1); r } }; f(1001)", errorResult("调用栈过深: 超过1000层")},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + 0 } }; f(1001)", errorResult("调用栈过深: 超过1000层")},
+		// 尾调用其他函数照常调用
+		{"let g = fn(x) { x * 2 }; let f = fn(x) { g(x + 1) }; f(1)", 4},
+		{"let f = fn(n) { if (n == 0) { n / 0 } else { f(n - 1) } }; f(3)", errorResult("除以零")},
+		// 无限的尾递归超过尾调用次数限制后结束
+		{"let f = fn(n) { f(n) }; f(1)", errorResult("尾调用次数过多: 超过1000000次")},
+	}
+	// 同一个Evaluator连续评估，每次结束后调用层数都要恢复
+	e := New()
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		testObject(t, e.Eval(program, object.NewEnvironment()), tt.expected)
+		if e.depth != 0 {
+			t.Errorf("depth not restored. got=%d", e.depth)
+			e.depth = 0
+		}
+	}
+
+	// 尾调用的参数数量不对时，错误位置是尾调用所在的位置
+	evaluated := testEval("let f = fn(n) { if (n == 0) { f(1, 2) } else { f(n - 1) } }; f(3)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "参数数量不匹配: 期望1个, 实际2个" || errObj.Line != 1 || errObj.Column != 32 {
+		t.Errorf("wrong error. got=%q at %d:%d", errObj.Message, errObj.Line, errObj.Column)
+	}
+}
+
+func TestTailCallWithDefer(t *testing.T) {
+	// 有defer的函数按普通调用处理，defer在被调用的函数返回之后才执行
+	evaluated, output := captureOutput(`let f = fn(n) { defer puts(n); if (n == 0) { 0 } else { f(n - 1) } }; f(2)`)
+	testIntegerObject(t, evaluated, 0)
+	if output != "0\n1\n2\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestMemoizeBuiltin(t *testing.T) {
+	prelude := "let calls = 0; let square = memoize(fn(x) { calls = calls + 1; x * x }); "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{prelude + "square(3)", 9},
+		// 相同参数只调用一次
+		{prelude + "square(3); square(3); square(3); calls", 1},
+		{prelude + "square(3); square(4); square(3); square(4); calls", 2},
+		{prelude + "[square(2), square(2), calls]", []int64{4, 4, 1}},
+		// 类型不同的参数不会共用结果
+		{"let calls = 0; let f = memoize(fn(x) { calls = calls + 1; x }); f(1); f(\"1\"); f(true); f(1.0); calls", 4},
+		{"let calls = 0; let f = memoize(fn(a, b) { calls = calls + 1; a + b }); f(1, 2); f(2, 1); f(1, 2); calls", 2},
+		{"let calls = 0; let f = memoize(fn(xs) { calls = calls + 1; len(xs) }); f([1, 2]); f([1, 2]); f([1]); calls", 2},
+		// 结构相同但元素类型不同的参数不能共用结果
+		{`let f = memoize(fn(xs) { type(xs[0]) }); f([1]); f(["1"])`, "STRING"},
+		{`let f = memoize(fn(h) { type(h["a"]) }); f({"a": 1}); f({"a": "1"})`, "STRING"},
+		{`let f = memoize(fn(xs) { len(xs) }); f(["a,b"]); f(["a", "b"])`, 2},
+		{`let f = memoize(fn(xs) { len(xs) }); f([[1], 2]); f([[1, 2]])`, 1},
+		{`let f = memoize(fn(xs) { type(xs[0]) }); f([null]); f(["NULL"])`, "STRING"},
+		{"let calls = 0; let f = memoize(fn(h) { calls = calls + 1; h }); f({\"a\": 1, \"b\": 2}); f({\"b\": 2, \"a\": 1}); calls", 1},
+		{"let calls = 0; let f = memoize(fn(g) { calls = calls + 1; g() }); f(fn() { 1 }); f(fn() { 1 }); calls", 2},
+		{"let calls = 0; let f = memoize(fn(...xs) { calls = calls + 1; len(xs) }); f(); f(); f(1); calls", 2},
+		// 每次memoize都有独立的缓存
+		{"let calls = 0; let g = fn(x) { calls = calls + 1; x }; let a = memoize(g); let b = memoize(g); a(1); b(1); calls", 2},
+		{"let f = memoize(fn(x) { 10 / x }); f(0)", errorResult("除以零")},
+		{"let fib = memoize(fn(n) { n < 2 ? n : fib(n - 1) + fib(n - 2) }); fib(80)", 23416728348467685},
+		{"memoize(1)", errorResult("memoize不支持的参数类型，INTEGER")},
+		{"memoize()", errorResult("入参数量不正确，需要1个，实际0个")},
+	}
+	for _, tt := range tests {
+		testObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// 出错的结果不缓存，脚本里出错后就停止了，所以直接调用包装后的函数
+	env := object.NewEnvironment()
+	wrapped, ok := Eval(parser.New(lexer.New("let calls = 0; memoize(fn(x) { calls = calls + 1; 10 / x })")).ParseProgram(), env).(*evaluatorBuiltin)
+	if !ok {
+		t.Fatalf("memoize did not return a builtin")
+	}
+	e := New()
+	testErrorObject(t, wrapped.fn(e, newInteger(0)), "除以零")
+	testErrorObject(t, wrapped.fn(e, newInteger(0)), "除以零")
+	calls, _ := env.Get("calls")
+	testIntegerObject(t, calls, 2)
+}
+
+// recordingTracer 按顺序记录进入和退出的节点
+type recordingTracer struct {
+	events []string
+}
+
+func (rt *recordingTracer) Enter(node ast.Node) {
+	rt.events = append(rt.events, "enter "+nodeType(node))
+}
+
+func (rt *recordingTracer) Exit(node ast.Node, result object.Object) {
+	inspect := "nil"
+	if result != nil {
+		inspect = result.Inspect()
+	}
+	rt.events = append(rt.events, "exit "+nodeType(node)+" "+inspect)
+}
+
+func TestTrace(t *testing.T) {
+	tracer := &recordingTracer{}
+	e := New()
+	e.Trace = tracer
+	evaluated := testEvalWith(e, "let x = 1 + 2; x")
+	testIntegerObject(t, evaluated, 3)
+
+	expected := []string{
+		"enter Program",
+		"enter LetStatement",
+		"enter InfixExpression",
+		"enter IntegerLiteral",
+		"exit IntegerLiteral 1",
+		"enter IntegerLiteral",
+		"exit IntegerLiteral 2",
+		"exit InfixExpression 3",
+		"exit LetStatement nil",
+		"enter ExpressionStatement",
+		"enter Identifier",
+		"exit Identifier 3",
+		"exit ExpressionStatement 3",
+		"exit Program 3",
+	}
+	if strings.Join(tracer.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("trace wrong.\nwant:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(tracer.events, "\n"))
+	}
+}
+
+func TestTraceFunctionCall(t *testing.T) {
+	tracer := &recordingTracer{}
+	e := New()
+	e.Trace = tracer
+	evaluated := testEvalWith(e, "let f = fn(n) { if (n > 0) { f(n - 1) } else { n } }; f(1)")
+	testIntegerObject(t, evaluated, 0)
+
+	// 函数体也会被跟踪，尾部位置对自身的调用退出时结果是nil
+	var entered []string
+	tailExits := 0
+	for _, event := range tracer.events {
+		if strings.HasPrefix(event, "enter ") {
+			entered = append(entered, strings.TrimPrefix(event, "enter "))
+		}
+		if event == "exit CallExpression nil" {
+			tailExits++
+		}
+	}
+	if len(entered) != len(tracer.events)/2 {
+		t.Errorf("Enter and Exit not paired. got=%q", tracer.events)
+	}
+	if tailExits != 1 {
+		t.Errorf("tail call exits wrong. want=1, got=%d", tailExits)
+	}
+	blocks := 0
+	for _, name := range entered {
+		if name == "BlockStatement" {
+			blocks++
+		}
+	}
+	// 两次执行函数体，每次进入函数体和选中的分支
+	if blocks != 4 {
+		t.Errorf("BlockStatement entered %d times, want 4. trace=%q", blocks, entered)
+	}
+}
+
+func TestWriterTracer(t *testing.T) {
+	var buf bytes.Buffer
+	e := New()
+	e.Trace = &WriterTracer{Writer: &buf}
+	testEvalWith(e, "-1")
+
+	expected := `-> Program
+  -> ExpressionStatement
+    -> PrefixExpression
+      -> IntegerLiteral
+      <- IntegerLiteral: 1
+    <- PrefixExpression: -1
+  <- ExpressionStatement: -1
+<- Program: -1
+`
+	if buf.String() != expected {
+		t.Errorf("trace output wrong.\nwant:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,41 @@
+package evaluator
+
+import (
+	"fmt"
+	"interpreter/ast"
+	"interpreter/object"
+	"io"
+	"strings"
+)
+
+// Tracer 跟踪评估过程，评估每个节点前调用Enter，评估完成后调用Exit
+// 尾部位置对函数自身的调用会交给外层循环执行，这时Exit收到的result是nil
+type Tracer interface {
+	Enter(node ast.Node)
+	Exit(node ast.Node, result object.Object)
+}
+
+// WriterTracer 把进入的节点类型和评估结果逐行写到Writer，按嵌套层数缩进
+type WriterTracer struct {
+	Writer io.Writer
+	depth  int
+}
+
+func (wt *WriterTracer) Enter(node ast.Node) {
+	_, _ = fmt.Fprintf(wt.Writer, "%s-> %s\n", strings.Repeat("  ", wt.depth), nodeType(node))
+	wt.depth++
+}
+
+func (wt *WriterTracer) Exit(node ast.Node, result object.Object) {
+	wt.depth--
+	inspect := "nil"
+	if result != nil {
+		inspect = result.Inspect()
+	}
+	_, _ = fmt.Fprintf(wt.Writer, "%s<- %s: %s\n", strings.Repeat("  ", wt.depth), nodeType(node), inspect)
+}
+
+// nodeType 去掉包名的节点类型，比如 InfixExpression
+func nodeType(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
@@ -0,0 +1,136 @@
+package interp
+
+import (
+	"fmt"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"math"
+	"reflect"
+)
+
+// ToObject 把宿主程序的Go值转换成Monkey的值，用于在评估前注入到环境中
+// 支持nil、布尔、各种整数、浮点数、字符串、切片和数组、键为字符串/整数/布尔的map，以及object.BuiltinFunction
+// 已经是object.Object的值原样返回，无法转换的类型返回error
+func ToObject(v interface{}) (object.Object, error) {
+	switch v := v.(type) {
+	case nil:
+		return evaluator.NULL, nil
+	case object.Object:
+		return v, nil
+	case object.BuiltinFunction:
+		return &object.Builtin{Fn: v}, nil
+	case func(args ...object.Object) object.Object:
+		return &object.Builtin{Fn: v}, nil
+	}
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		// 布尔值必须用evaluator里的单例，否则if判断真假时会出错
+		if v.Bool() {
+			return evaluator.TRUE, nil
+		}
+		return evaluator.FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("整数超出范围: %d", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return ToObject(v.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return &object.Array{Elements: []object.Object{}}, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := ToObject(v.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := ToObject(iter.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("无法作为哈希的键: %s", iter.Key().Type())
+			}
+			value, err := ToObject(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+	default:
+		return nil, fmt.Errorf("无法转换为Monkey的值: %s", v.Type())
+	}
+}
+
+// FromObject 把评估结果转换成Go的值，ToObject的逆操作
+// 整数转成int64，小数转成float64，数组转成[]interface{}，哈希转成map[string]interface{}，键取Inspect的结果
+// 函数、错误这类没有对应Go值的对象返回error
+func FromObject(o object.Object) (interface{}, error) {
+	switch o := o.(type) {
+	case *object.Integer:
+		return o.Value, nil
+	case *object.Float:
+		return o.Value, nil
+	case *object.String:
+		return o.Value, nil
+	case *object.Boolean:
+		return o.Value, nil
+	case *object.Null:
+		return nil, nil
+	case *object.Array:
+		values := make([]interface{}, len(o.Elements))
+		for i, el := range o.Elements {
+			value, err := FromObject(el)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case *object.Hash:
+		values := make(map[string]interface{}, len(o.Pairs))
+		for _, pair := range o.Pairs {
+			key := pair.Key.Inspect()
+			if _, ok := values[key]; ok {
+				// 比如整数1和字符串"1"
+				return nil, fmt.Errorf("哈希的键转换成字符串后重复: %s", key)
+			}
+			value, err := FromObject(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		}
+		return values, nil
+	case *object.Error:
+		return nil, fmt.Errorf("无法转换错误对象: %s", o.Inspect())
+	case nil:
+		return nil, fmt.Errorf("无法转换为Go的值: nil")
+	default:
+		return nil, fmt.Errorf("无法转换为Go的值: %s", o.Type())
+	}
+}
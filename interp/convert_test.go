@@ -0,0 +1,167 @@
+package interp
+
+import (
+	"interpreter/object"
+	"reflect"
+	"testing"
+)
+
+func TestToObject(t *testing.T) {
+	n := 7
+	tests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint32(9), "9"},
+		{&n, "7"},
+		{1.5, "1.5"},
+		{"monkey", "monkey"},
+		{[]int{1, 2, 3}, "[1, 2, 3]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]interface{}{1, "x", nil, []bool{false}}, "[1, x, null, [false]]"},
+		{map[string]int{"a": 1}, "{a: 1}"},
+		{map[int]bool{2: true}, "{2: true}"},
+		{&object.Integer{Value: 5}, "5"},
+	}
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    interface{}
+		expected string
+	}{
+		{struct{}{}, "无法转换为Monkey的值: struct {}"},
+		{uint64(1 << 63), "整数超出范围: 9223372036854775808"},
+		{map[float64]int{1.5: 1}, "无法作为哈希的键: float64"},
+		{[]interface{}{make(chan int)}, "无法转换为Monkey的值: chan int"},
+	}
+	for _, tt := range errorTests {
+		_, err := ToObject(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("ToObject(%T) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunWithHostValues(t *testing.T) {
+	program, err := Parse(`let total = 0; for (x in xs) { total = total + x * weights[str(x)] }; double(total)`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	double := func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	}
+
+	// 同一棵语法树在不同的环境里评估
+	tests := []struct {
+		xs       []int
+		weights  map[string]int
+		expected int64
+	}{
+		{[]int{1, 2, 3}, map[string]int{"1": 1, "2": 1, "3": 1}, 12},
+		{[]int{2, 5}, map[string]int{"2": 10, "5": 2}, 60},
+		{[]int{}, map[string]int{}, 0},
+	}
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		for name, value := range map[string]interface{}{"xs": tt.xs, "weights": tt.weights, "double": double} {
+			obj, err := ToObject(value)
+			if err != nil {
+				t.Fatalf("ToObject returned error: %s", err)
+			}
+			env.Set(name, obj)
+		}
+		result := Run(program, env)
+		integer, ok := result.(*object.Integer)
+		if !ok {
+			t.Fatalf("result is not Integer. got=%T (%+v)", result, result)
+		}
+		if integer.Value != tt.expected {
+			t.Errorf("wrong result. want=%d, got=%d", tt.expected, integer.Value)
+		}
+	}
+
+	if _, err := Parse("let = 1;"); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`5`, int64(5)},
+		{`-1.5`, -1.5},
+		{`"monkey"`, "monkey"},
+		{`true`, true},
+		{`null`, nil},
+		{`[1, "a", [false, null]]`, []interface{}{int64(1), "a", []interface{}{false, nil}}},
+		{`{"a": 1, 2: [3], true: {"x": "y"}}`, map[string]interface{}{
+			"a":    int64(1),
+			"2":    []interface{}{int64(3)},
+			"true": map[string]interface{}{"x": "y"},
+		}},
+	}
+	for _, tt := range tests {
+		result, err := Interpret(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		value, err := FromObject(result)
+		if err != nil {
+			t.Errorf("FromObject(%s) returned error: %s", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("FromObject(%s) wrong. want=%#v, got=%#v", tt.input, tt.expected, value)
+		}
+	}
+
+	// Go的值转换过去再转换回来保持不变
+	original := map[string]interface{}{"list": []interface{}{int64(1), "two", true}, "nested": map[string]interface{}{"n": nil}}
+	obj, err := ToObject(original)
+	if err != nil {
+		t.Fatalf("ToObject returned error: %s", err)
+	}
+	back, err := FromObject(obj)
+	if err != nil {
+		t.Fatalf("FromObject returned error: %s", err)
+	}
+	if !reflect.DeepEqual(back, original) {
+		t.Errorf("round trip changed the value. want=%#v, got=%#v", original, back)
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(x) { x }`, "无法转换为Go的值: FUNCTION"},
+		{`len`, "无法转换为Go的值: BUILTIN"},
+		{`[1, fn() {}]`, "无法转换为Go的值: FUNCTION"},
+		{`1 + true`, "无法转换错误对象: ERROR: 第1行: 类型不匹配: INTEGER + BOOLEAN"},
+		{`{1: "a", "1": "b"}`, "哈希的键转换成字符串后重复: 1"},
+	}
+	for _, tt := range errorTests {
+		result, err := Interpret(tt.input)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, err = FromObject(result)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("FromObject(%s) wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
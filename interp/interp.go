@@ -0,0 +1,50 @@
+package interp
+
+import (
+	"errors"
+	"interpreter/ast"
+	"interpreter/evaluator"
+	"interpreter/lexer"
+	"interpreter/object"
+	"interpreter/parser"
+	"strings"
+)
+
+// Interpret 词法分析、语法分析后在新的环境中评估源码
+// 语法错误合并成一个error返回，运行时错误以object.Error作为结果返回
+// 脚本调用exit()提前结束时，结果是带有退出码的object.Exit
+func Interpret(source string) (object.Object, error) {
+	return InterpretWithEnv(source, object.NewEnvironment())
+}
+
+// InterpretWithEnv 在已有的环境中评估源码，用于REPL这类需要保留变量的场景
+func InterpretWithEnv(source string, env *object.Environment) (object.Object, error) {
+	program, err := Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	return Run(program, env), nil
+}
+
+// Parse 只做词法分析和语法分析，语法错误合并成一个error返回
+// 解析出的语法树可以交给Run反复评估，不用每次都重新解析
+func Parse(source string) (*ast.Program, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+	return program, nil
+}
+
+// Run 在env中评估已经解析好的程序，语法树不会被修改，可以在不同的环境里重复使用
+// 宿主程序的值先用ToObject转换，再用env.Set注入到环境里
+func Run(program *ast.Program, env *object.Environment) object.Object {
+	return evaluator.Eval(program, env)
+}
+
+// RunWith 与Run相同，但使用指定的Evaluator，需要修改输出位置、开启文件读写或注册内置函数时使用
+func RunWith(e *evaluator.Evaluator, program *ast.Program, env *object.Environment) object.Object {
+	return e.Eval(program, env)
+}
@@ -0,0 +1,88 @@
+package interp
+
+import (
+	"bytes"
+	"interpreter/evaluator"
+	"interpreter/object"
+	"testing"
+)
+
+func TestInterpret(t *testing.T) {
+	result, err := Interpret("let add = fn(a, b) { a + b }; add(2, 3);")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	integer, ok := result.(*object.Integer)
+	if !ok {
+		t.Fatalf("result is not Integer. got=%T (%+v)", result, result)
+	}
+	if integer.Value != 5 {
+		t.Errorf("result has wrong value. got=%d, want=5", integer.Value)
+	}
+}
+
+func TestInterpretParseError(t *testing.T) {
+	result, err := Interpret("let x 5;\nlet = 1;")
+	if err == nil {
+		t.Fatalf("expected parse error. got result=%+v", result)
+	}
+	if result != nil {
+		t.Errorf("result should be nil on parse error. got=%+v", result)
+	}
+	expected := "第1行第7列: 期望下一个token是 =，但是实际是 INT\n" +
+		"第2行第5列: 期望下一个token是 IDENT，但是实际是 ="
+	if err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+}
+
+func TestInterpretRuntimeError(t *testing.T) {
+	result, err := Interpret("1 + true")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("result is not Error. got=%T (%+v)", result, result)
+	}
+	if errObj.Message != "类型不匹配: INTEGER + BOOLEAN" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestInterpretWithEnv(t *testing.T) {
+	env := object.NewEnvironment()
+	if _, err := InterpretWithEnv("let x = 10;", env); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := InterpretWithEnv("x * 2", env)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 20 {
+		t.Errorf("wrong result. got=%+v", result)
+	}
+}
+
+func TestInterpretExit(t *testing.T) {
+	var out bytes.Buffer
+	e := evaluator.New()
+	e.Output = &out
+
+	program, err := Parse(`puts("before"); let f = fn() { exit(3); puts("in f") }; f(); puts("after")`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result := RunWith(e, program, object.NewEnvironment())
+	exit, ok := result.(*object.Exit)
+	if !ok {
+		t.Fatalf("result is not Exit. got=%T (%+v)", result, result)
+	}
+	if exit.Code != 3 {
+		t.Errorf("exit has wrong code. got=%d, want=3", exit.Code)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("statements after exit were evaluated. output=%q", out.String())
+	}
+}
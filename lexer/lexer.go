@@ -1,17 +1,24 @@
 package lexer
 
-import "interpreter/token"
+import (
+	"interpreter/token"
+	"strings"
+)
 
 type Lexer struct {
-	input        string // 输入的字符串
-	position     int    // 当前读取的位置
-	readPosition int    // 下一个读取的位置
-	ch           byte   // 当前读取的值
+	input        string     // 输入的字符串
+	position     int        // 当前读取的位置
+	readPosition int        // 下一个读取的位置
+	ch           byte       // 当前读取的值
+	line         int        // 当前字符所在行
+	column       int        // 当前字符所在列
+	prevType     token.Type // 上一个token的类型，用来区分 i-- 和 5--3
 }
 
 func New(input string) *Lexer {
 	l := &Lexer{
 		input: input,
+		line:  1,
 	}
 	// 读一位，让lexer处于工作状态，readPosition变1了
 	l.readChar()
@@ -19,6 +26,12 @@ func New(input string) *Lexer {
 }
 
 func (l *Lexer) readChar() {
+	// 上一个字符是换行，那新读的字符就在下一行的开头
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -37,8 +50,16 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.prevType = tok.Type
+	return tok
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
+	// 记录token开始的位置
+	line, column := l.line, l.column
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -50,9 +71,21 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.isIncDec() {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.INCREMENT, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.isIncDec() {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.DECREMENT, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
 		tok = newToken(token.ASTERISK, l.ch)
 	case '/':
@@ -66,9 +99,37 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.LTE, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.LSHIFT, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.GTE, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.Token{Type: token.RSHIFT, Literal: string(ch) + string(l.ch)}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		tok = newToken(token.AMPERSAND, l.ch)
+	case '|':
+		tok = newToken(token.PIPE, l.ch)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case '(':
@@ -90,29 +151,63 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], token.ELLIPSIS) {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: token.ELLIPSIS}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case 0:
 		// 读到结尾了
 		tok.Literal = ""
 		tok.Type = token.EOF
 	default:
-		if isLetter(l.ch) {
+		if l.ch == '_' && l.underscoresBeforeDigit() {
+			// _100 当作位置不正确的数字，交给parser报错，而不是拆成标识符 _ 和数字 100
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Line, tok.Column = line, column
+			return tok
+		} else if isLetter(l.ch) {
 			// readIdentifier 读到了非字符串的部分，所以不需要再readChar到下一位，可以直接return
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
+	tok.Line, tok.Column = line, column
 	// 准备下一位
 	l.readChar()
 	return tok
 }
 
+// isIncDec 当前是++或--，并且应该作为自增自减：只能紧跟在标识符后面，同一行里后面也不能紧接着运算数
+// 其余情况还是两个+或-，这样 5--3、--5、x--1 仍然按减去负数解析
+func (l *Lexer) isIncDec() bool {
+	if l.peekChar() != l.ch || l.prevType != token.IDENT {
+		return false
+	}
+	i := l.readPosition + 1
+	for i < len(l.input) && (l.input[i] == ' ' || l.input[i] == '\t') {
+		i++
+	}
+	if i == len(l.input) {
+		return true
+	}
+	ch := l.input[i]
+	return !isLetter(ch) && !isDigit(ch) && ch != '(' && ch != '[' && ch != '"' && ch != '!' && ch != '~'
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 }
@@ -130,12 +225,51 @@ func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber 读取整数或小数，小数点两边都必须有数字，1. 和 .5 都不是小数
+func (l *Lexer) readNumber() (string, token.Type) {
 	position := l.position
-	for isDigit(l.ch) {
+	if l.ch == '0' && isRadixPrefix(l.peekChar()) {
+		// 0x 0o 0b 前缀，后面的字母数字都算进来，是否合法交给parser的strconv.ParseInt判断
+		l.readChar()
 		l.readChar()
+		for isLetter(l.ch) || isDigit(l.ch) {
+			l.readChar()
+		}
+		return l.input[position:l.position], token.INT
+	}
+	// 允许下划线作为数字分隔符 1_000_000，位置是否合法交给parser判断
+	l.readDigits()
+	if l.ch != '.' || !isDigit(l.peekChar()) {
+		return l.input[position:l.position], token.INT
+	}
+	// 跳过小数点
+	l.readChar()
+	l.readDigits()
+	return l.input[position:l.position], token.FLOAT
+}
+
+// underscoresBeforeDigit 从当前位置开始的一串下划线后面是否紧跟着数字
+func (l *Lexer) underscoresBeforeDigit() bool {
+	i := l.position
+	for i < len(l.input) && l.input[i] == '_' {
+		i++
+	}
+	return i < len(l.input) && isDigit(l.input[i])
+}
+
+func (l *Lexer) readDigits() {
+	for isDigit(l.ch) || l.ch == '_' {
+		l.readChar()
+	}
+}
+
+func isRadixPrefix(ch byte) bool {
+	switch ch {
+	case 'x', 'X', 'o', 'O', 'b', 'B':
+		return true
+	default:
+		return false
 	}
-	return l.input[position:l.position]
 }
 
 func (l *Lexer) readString() string {
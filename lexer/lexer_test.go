@@ -28,6 +28,7 @@ func TestNextToken(t *testing.T) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+5 <= 10 >= 5;
 `
 
 	tests := []struct {
@@ -120,6 +121,267 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.INT, "5"},
+		{token.LTE, "<="},
+		{token.INT, "10"},
+		{token.GTE, ">="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x == "a
+b";
+	fn`
+
+	tests := []struct {
+		expectedType   token.Type
+		expectedLine   int
+		expectedColumn int
+	}{
+		{token.LET, 1, 1},
+		{token.IDENT, 1, 5},
+		{token.ASSIGN, 1, 7},
+		{token.INT, 1, 9},
+		{token.SEMICOLON, 1, 10},
+		{token.IDENT, 2, 3},
+		{token.EQ, 2, 5},
+		{token.STRING, 2, 8},
+		{token.SEMICOLON, 3, 3},
+		{token.FUNCTION, 4, 2},
+		{token.EOF, 4, 4},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestRadixNumbers(t *testing.T) {
+	input := `0xFF 0o17 017 0b101 0XaB 0xZZ 0 10`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF"},
+		{token.INT, "0o17"},
+		{token.INT, "017"},
+		{token.INT, "0b101"},
+		{token.INT, "0XaB"},
+		{token.INT, "0xZZ"},
+		{token.INT, "0"},
+		{token.INT, "10"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	input := `fn(a, ...rest) . ..`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RPAREN, ")"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestFloatNumbers(t *testing.T) {
+	input := `3.14 0.5 1_000.25 10 1.x 2..3`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1_000.25"},
+		{token.INT, "10"},
+		{token.INT, "1"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.INT, "2"},
+		{token.DOT, "."},
+		{token.DOT, "."},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestLeadingUnderscoreNumbers(t *testing.T) {
+	// 下划线后面紧跟数字时整体作为数字，由parser报告下划线位置不正确
+	input := `_100 __2 _x _`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.INT, "_100"},
+		{token.INT, "__2"},
+		{token.IDENT, "_x"},
+		{token.IDENT, "_"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestIncrementDecrementDisambiguation(t *testing.T) {
+	// 只有紧跟在标识符后面、同一行后面没有运算数时才是++和--
+	tests := []struct {
+		input    string
+		expected []token.Type
+	}{
+		{"5--3", []token.Type{token.INT, token.MINUS, token.MINUS, token.INT}},
+		{"--5", []token.Type{token.MINUS, token.MINUS, token.INT}},
+		{"x--1", []token.Type{token.IDENT, token.MINUS, token.MINUS, token.INT}},
+		{"x-- (y)", []token.Type{token.IDENT, token.MINUS, token.MINUS, token.LPAREN, token.IDENT, token.RPAREN}},
+		{"x++y", []token.Type{token.IDENT, token.PLUS, token.PLUS, token.IDENT}},
+		{"(x)--", []token.Type{token.LPAREN, token.IDENT, token.RPAREN, token.MINUS, token.MINUS}},
+		{"x--", []token.Type{token.IDENT, token.DECREMENT}},
+		{"x-- - 1", []token.Type{token.IDENT, token.DECREMENT, token.MINUS, token.INT}},
+		{"x++;", []token.Type{token.IDENT, token.INCREMENT, token.SEMICOLON}},
+		{"f(x++)", []token.Type{token.IDENT, token.LPAREN, token.IDENT, token.INCREMENT, token.RPAREN}},
+		{"x--\ny", []token.Type{token.IDENT, token.DECREMENT, token.IDENT}},
+	}
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range append(tt.expected, token.EOF) {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Errorf("%q tokens[%d] - tokentype wrong. expected=%q, got=%q", tt.input, i, expected, tok.Type)
+				break
+			}
+		}
+	}
+}
+
+func TestOperatorsAndKeywords(t *testing.T) {
+	input := `a & b | c ^ d << 1 >> 2 < <= > >= ~a i++; j-- - -k for in`
+
+	tests := []struct {
+		expectedType    token.Type
+		expectedLiteral string
+	}{
+		{token.IDENT, "a"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "b"},
+		{token.PIPE, "|"},
+		{token.IDENT, "c"},
+		{token.CARET, "^"},
+		{token.IDENT, "d"},
+		{token.LSHIFT, "<<"},
+		{token.INT, "1"},
+		{token.RSHIFT, ">>"},
+		{token.INT, "2"},
+		{token.LT, "<"},
+		{token.LTE, "<="},
+		{token.GT, ">"},
+		{token.GTE, ">="},
+		{token.TILDE, "~"},
+		{token.IDENT, "a"},
+		{token.IDENT, "i"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "j"},
+		{token.DECREMENT, "--"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.IDENT, "k"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
 		{token.EOF, ""},
 	}
 
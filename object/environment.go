@@ -1,8 +1,15 @@
 package object
 
+import (
+	"interpreter/ast"
+	"sort"
+)
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store    map[string]Object
+	outer    *Environment
+	consts   map[string]bool  // 用const定义的变量名
+	deferred []ast.Expression // defer登记的表达式，函数返回时按后进先出执行
 }
 
 func NewEnvironment() *Environment {
@@ -29,3 +36,133 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// SetConst 定义常量，之后在这个作用域里不能再用let或赋值修改
+func (e *Environment) SetConst(name string, val Object) Object {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+	e.store[name] = val
+	return val
+}
+
+// IsConst 沿作用域链找到最近定义name的环境，判断它是不是常量
+func (e *Environment) IsConst(name string) bool {
+	if _, ok := e.store[name]; ok {
+		return e.consts[name]
+	}
+	if e.outer != nil {
+		return e.outer.IsConst(name)
+	}
+	return false
+}
+
+// IsLocalConst 判断name是不是当前作用域里定义的常量，内层作用域可以用let遮蔽外层的常量
+func (e *Environment) IsLocalConst(name string) bool {
+	return e.consts[name]
+}
+
+// Assign 给已定义的变量重新赋值，沿着作用域链找到变量所在的环境后修改，变量未定义时返回false
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return val, true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return nil, false
+}
+
+// Keys 当前作用域中定义的变量名，按字典序排列
+// includeOuter为true时包括所有外层作用域中的变量，内外层同名的变量只出现一次
+func (e *Environment) Keys(includeOuter bool) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0, len(e.store))
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			if !seen[name] {
+				seen[name] = true
+				keys = append(keys, name)
+			}
+		}
+		if !includeOuter {
+			break
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Defer 登记一条延迟执行的表达式
+func (e *Environment) Defer(expr ast.Expression) {
+	e.deferred = append(e.deferred, expr)
+}
+
+// HasDeferred 是否有还没执行的defer
+func (e *Environment) HasDeferred() bool {
+	return len(e.deferred) > 0
+}
+
+// TakeDeferred 取出登记的延迟表达式（按登记顺序），并清空登记
+func (e *Environment) TakeDeferred() []ast.Expression {
+	deferred := e.deferred
+	e.deferred = nil
+	return deferred
+}
+
+// Clone 复制出一个独立的环境，用于从同一组预先定义好的变量开始多次互不影响的评估
+// 外层环境会沿着作用域链一起复制，所以在副本里给外层变量赋值也不会影响原来的环境
+// 整数、字符串这类不可变的值直接共用；数组和哈希会复制一份，函数复制后指向复制出来的环境，
+// 这样副本里调用的闭包修改的也是副本里的变量
+func (e *Environment) Clone() *Environment {
+	return e.clone(make(map[*Environment]*Environment))
+}
+
+// clone 按指针记录已经复制过的环境，多个函数共用同一个环境时副本里也共用
+func (e *Environment) clone(cloned map[*Environment]*Environment) *Environment {
+	if e == nil {
+		return nil
+	}
+	if env, ok := cloned[e]; ok {
+		return env
+	}
+	env := &Environment{store: make(map[string]Object, len(e.store))}
+	cloned[e] = env
+	env.outer = e.outer.clone(cloned)
+	for name, val := range e.store {
+		env.store[name] = cloneValue(val, cloned)
+	}
+	if e.consts != nil {
+		env.consts = make(map[string]bool, len(e.consts))
+		for name := range e.consts {
+			env.consts[name] = true
+		}
+	}
+	env.deferred = append([]ast.Expression(nil), e.deferred...)
+	return env
+}
+
+func cloneValue(val Object, cloned map[*Environment]*Environment) Object {
+	switch val := val.(type) {
+	case *Array:
+		elements := make([]Object, len(val.Elements))
+		for i, el := range val.Elements {
+			elements[i] = cloneValue(el, cloned)
+		}
+		return &Array{Elements: elements}
+	case *Hash:
+		pairs := make(map[HashKey]HashPair, len(val.Pairs))
+		for k, pair := range val.Pairs {
+			pairs[k] = HashPair{Key: pair.Key, Value: cloneValue(pair.Value, cloned)}
+		}
+		return &Hash{Pairs: pairs}
+	case *Function:
+		fn := *val
+		fn.Env = val.Env.clone(cloned)
+		return &fn
+	default:
+		return val
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"hash/fnv"
 	"interpreter/ast"
+	"strconv"
 	"strings"
 )
 
@@ -13,6 +14,7 @@ type BuiltinFunction func(args ...Object) Object
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	ARRAY_OBJ        = "ARRAY"
@@ -20,6 +22,7 @@ const (
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
+	EXIT_OBJ         = "EXIT"
 	FUNCTION_OBJ     = "FUNCTION"
 	BUILTIN_OBJ      = "BUILTIN"
 )
@@ -36,6 +39,7 @@ type Hashable interface {
 type HashKey struct {
 	Type
 	Value uint64
+	Text  string // 字符串键的原始值，两个不同的字符串FNV哈希值相同时靠它区分，避免互相覆盖
 }
 
 type HashPair struct {
@@ -79,6 +83,23 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() Type {
+	return FLOAT_OBJ
+}
+
+// Inspect 整数值的小数也保留.0，避免和整数混淆
+func (f *Float) Inspect() string {
+	str := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".eIN") {
+		str += ".0"
+	}
+	return str
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -127,6 +148,8 @@ func (rv *ReturnValue) Inspect() string {
 
 type Error struct {
 	Message string
+	Line    int // 出错位置，为0时表示没有位置信息
+	Column  int
 }
 
 func (e *Error) Type() Type {
@@ -134,11 +157,29 @@ func (e *Error) Type() Type {
 }
 
 func (e *Error) Inspect() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("ERROR: 第%d行: %s", e.Line, e.Message)
+	}
 	return "ERROR: " + e.Message
 }
 
+// Exit 调用exit()后产生，像错误一样一路返回到顶层，结束整个程序的评估
+type Exit struct {
+	Code int64 // 退出码
+}
+
+func (e *Exit) Type() Type {
+	return EXIT_OBJ
+}
+
+func (e *Exit) Inspect() string {
+	return fmt.Sprintf("exit(%d)", e.Code)
+}
+
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // 参数的默认值，没有默认值的是nil
+	Rest       *ast.Identifier  // 可变参数，多出来的参数收集成数组绑定到它上面
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -150,9 +191,16 @@ func (f *Function) Type() Type {
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 	params := make([]string, 0)
-	for _, p := range f.Parameters {
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 	out.WriteString("fn")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
@@ -174,8 +222,13 @@ func (s *String) Inspect() string {
 	return s.Value
 }
 
+// InspectQuoted 加上引号并转义引号、换行等字符，用于显示求值结果，Inspect则是puts打印的原始内容
+func (s *String) InspectQuoted() string {
+	return strconv.Quote(s.Value)
+}
+
 func (s *String) HashKey() HashKey {
-	key := HashKey{Type: STRING_OBJ}
+	key := HashKey{Type: STRING_OBJ, Text: s.Value}
 	h := fnv.New64a()
 	_, _ = h.Write([]byte(s.Value))
 	key.Value = h.Sum64()
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +23,129 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestStringHashKeyCollision(t *testing.T) {
+	a := (&String{Value: "a"}).HashKey()
+	b := (&String{Value: "b"}).HashKey()
+	// 模拟两个不同的字符串FNV哈希值相同的情况
+	b.Value = a.Value
+
+	if a == b {
+		t.Fatalf("hash keys of different strings are equal when hash values collide")
+	}
+
+	pairs := map[HashKey]HashPair{
+		a: {Key: &String{Value: "a"}, Value: &Integer{Value: 1}},
+		b: {Key: &String{Value: "b"}, Value: &Integer{Value: 2}},
+	}
+	if len(pairs) != 2 {
+		t.Errorf("colliding keys clobbered each other. got %d pairs", len(pairs))
+	}
+	if pairs[a].Value.(*Integer).Value != 1 || pairs[b].Value.(*Integer).Value != 2 {
+		t.Errorf("wrong values for colliding keys. got=%v", pairs)
+	}
+}
+
+func TestEnvironmentKeys(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("b", &Integer{Value: 1})
+	outer.Set("a", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("c", &Integer{Value: 3})
+
+	keys := outer.Keys(false)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("wrong outer keys. got=%v", keys)
+	}
+	if keys := outer.Keys(true); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("wrong outer keys with includeOuter. got=%v", keys)
+	}
+	keys = inner.Keys(false)
+	if len(keys) != 1 || keys[0] != "c" {
+		t.Errorf("wrong inner keys. got=%v", keys)
+	}
+
+	// 内层遮蔽外层的同名变量时只出现一次
+	inner.Set("a", &Integer{Value: 4})
+	innermost := NewEnclosedEnvironment(inner)
+	innermost.Set("d", &Integer{Value: 5})
+	keys = innermost.Keys(true)
+	if strings.Join(keys, ",") != "a,b,c,d" {
+		t.Errorf("wrong keys with includeOuter. got=%v", keys)
+	}
+	if keys := innermost.Keys(false); len(keys) != 1 || keys[0] != "d" {
+		t.Errorf("wrong innermost keys. got=%v", keys)
+	}
+	if keys := NewEnvironment().Keys(true); len(keys) != 0 {
+		t.Errorf("empty environment has keys. got=%v", keys)
+	}
+}
+
+func TestEnvironmentClone(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	outer.SetConst("c", &String{Value: "const"})
+	env := NewEnclosedEnvironment(outer)
+	env.Set("list", &Array{Elements: []Object{&Integer{Value: 1}}})
+
+	clone := env.Clone()
+	if clone == env || clone.outer == outer {
+		t.Fatalf("clone shares environments with the original")
+	}
+
+	// 修改副本不影响原来的环境
+	clone.Set("y", &Integer{Value: 2})
+	clone.Assign("x", &Integer{Value: 10})
+	if _, ok := env.Get("y"); ok {
+		t.Errorf("new variable in clone is visible in original")
+	}
+	if x, _ := env.Get("x"); x.(*Integer).Value != 1 {
+		t.Errorf("assigning outer variable in clone changed original. got=%d", x.(*Integer).Value)
+	}
+	cloneList, _ := clone.Get("list")
+	cloneList.(*Array).Elements[0] = &Integer{Value: 99}
+	if list, _ := env.Get("list"); list.Inspect() != "[1]" {
+		t.Errorf("modifying cloned array changed original. got=%s", list.Inspect())
+	}
+
+	// 修改原来的环境也不影响副本
+	env.Set("z", &Integer{Value: 3})
+	outer.Assign("x", &Integer{Value: 20})
+	if _, ok := clone.Get("z"); ok {
+		t.Errorf("new variable in original is visible in clone")
+	}
+	if x, _ := clone.Get("x"); x.(*Integer).Value != 10 {
+		t.Errorf("assigning in original changed clone. got=%d", x.(*Integer).Value)
+	}
+
+	if !clone.IsConst("c") {
+		t.Errorf("const was not cloned")
+	}
+	if keys := clone.Keys(false); len(keys) != 2 || keys[0] != "list" || keys[1] != "y" {
+		t.Errorf("wrong clone keys. got=%v", keys)
+	}
+}
+
+func TestStringInspectQuoted(t *testing.T) {
+	tests := []struct {
+		value    string
+		raw      string
+		expected string
+	}{
+		{"hello", "hello", `"hello"`},
+		{"a\nb", "a\nb", `"a\nb"`},
+		{`say "hi"`, `say "hi"`, `"say \"hi\""`},
+		{"tab\there\\", "tab\there\\", `"tab\there\\"`},
+		{"你好", "你好", `"你好"`},
+		{"", "", `""`},
+	}
+	for _, tt := range tests {
+		str := &String{Value: tt.value}
+		if str.Inspect() != tt.raw {
+			t.Errorf("Inspect() wrong. want=%q, got=%q", tt.raw, str.Inspect())
+		}
+		if str.InspectQuoted() != tt.expected {
+			t.Errorf("InspectQuoted() wrong. want=%s, got=%s", tt.expected, str.InspectQuoted())
+		}
+	}
+}
@@ -6,17 +6,27 @@ import (
 	"interpreter/lexer"
 	"interpreter/token"
 	"strconv"
+	"strings"
 )
 
+// 位运算的优先级与C一致，&、^、| 低于比较，所以 x & 1 == 0 要写成 (x & 1) == 0
+// 移位高于加减，1 << 2 + 1 是 (1 << 2) + 1
 const (
 	// 优先级
 	_ int = iota
 	LOWEST
+	ASSIGN      // x = 5
+	TERNARY     // a ? b : c
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
 	EQUALS      // ==
 	LESSGREATER // < or >
 	SUM         // +
+	SHIFT       // << or >>
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POSTFIX     // X++ or X--
 	CALL        // add(X)
 	INDEX       // arr[i]
 )
@@ -24,51 +34,81 @@ const (
 var (
 	// 优先级表
 	precedences = map[token.Type]int{
-		token.EQ:       EQUALS,
-		token.NEQ:      EQUALS,
-		token.LT:       LESSGREATER,
-		token.GT:       LESSGREATER,
-		token.PLUS:     SUM,
-		token.MINUS:    SUM,
-		token.SLASH:    PRODUCT,
-		token.ASTERISK: PRODUCT,
-		token.LPAREN:   CALL,
-		token.LBRACKET: INDEX,
+		token.ASSIGN:    ASSIGN,
+		token.QUESTION:  TERNARY,
+		token.EQ:        EQUALS,
+		token.NEQ:       EQUALS,
+		token.LT:        LESSGREATER,
+		token.GT:        LESSGREATER,
+		token.LTE:       LESSGREATER,
+		token.GTE:       LESSGREATER,
+		token.PIPE:      BITOR,
+		token.CARET:     BITXOR,
+		token.AMPERSAND: BITAND,
+		token.LSHIFT:    SHIFT,
+		token.RSHIFT:    SHIFT,
+		token.PLUS:      SUM,
+		token.MINUS:     SUM,
+		token.SLASH:     PRODUCT,
+		token.ASTERISK:  PRODUCT,
+		token.LPAREN:    CALL,
+		token.INCREMENT: POSTFIX,
+		token.DECREMENT: POSTFIX,
+		token.LBRACKET:  INDEX,
+		token.DOT:       INDEX,
+	}
+)
+
+var (
+	// 语句开头的关键字，出错后从这里恢复解析
+	statementStarts = map[token.Type]bool{
+		token.LET:    true,
+		token.CONST:  true,
+		token.RETURN: true,
+		token.DEFER:  true,
+		token.FOR:    true,
 	}
 )
 
 type (
-	// 本例不实现后缀表达式 a++
-	prefixParseFn func() ast.Expression                        // 前缀表达式解析 !true -2
-	infixParseFn  func(leftExpr ast.Expression) ast.Expression // 中缀表达式解析 1+2 a!=b
+	prefixParseFn  func() ast.Expression                        // 前缀表达式解析 !true -2
+	infixParseFn   func(leftExpr ast.Expression) ast.Expression // 中缀表达式解析 1+2 a!=b
+	postfixParseFn func(leftExpr ast.Expression) ast.Expression // 后缀表达式解析 i++，不需要右边的操作数
 )
 
 type Parser struct {
-	l              *lexer.Lexer // 词法分析器
-	curToken       token.Token  // 当前
-	peekToken      token.Token  // 下一个，当cur没有足够信息来判断是，需要借助peek
-	errors         []string     // 解析过程中遇到的错误
-	prefixParseFns map[token.Type]prefixParseFn
-	infixParseFns  map[token.Type]infixParseFn
+	l               *lexer.Lexer // 词法分析器
+	curToken        token.Token  // 当前
+	peekToken       token.Token  // 下一个，当cur没有足够信息来判断是，需要借助peek
+	errors          []string     // 解析过程中遇到的错误
+	unexpectedEOF   bool         // 是否因为输入提前结束而出错
+	prefixParseFns  map[token.Type]prefixParseFn
+	infixParseFns   map[token.Type]infixParseFn
+	postfixParseFns map[token.Type]postfixParseFn
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:              l,
-		errors:         []string{},
-		prefixParseFns: map[token.Type]prefixParseFn{},
-		infixParseFns:  map[token.Type]infixParseFn{},
+		l:               l,
+		errors:          []string{},
+		prefixParseFns:  map[token.Type]prefixParseFn{},
+		infixParseFns:   map[token.Type]infixParseFn{},
+		postfixParseFns: map[token.Type]postfixParseFn{},
 	}
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.NULL, p.parseNull)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.WHILE, p.parseWhileExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -77,12 +117,29 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
 	p.registerInfix(token.EQ, p.parseInfixExpression)
 	p.registerInfix(token.NEQ, p.parseInfixExpression)
-	p.registerInfix(token.LT, p.parseInfixExpression)
-	p.registerInfix(token.GT, p.parseInfixExpression)
+	// 比较 a < b，连续比较 a < b < c
+	p.registerInfix(token.LT, p.parseComparisonExpression)
+	p.registerInfix(token.GT, p.parseComparisonExpression)
+	p.registerInfix(token.LTE, p.parseComparisonExpression)
+	p.registerInfix(token.GTE, p.parseComparisonExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(token.RSHIFT, p.parseInfixExpression)
+	// 赋值 <标识符> = <表达式>
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	// 三元运算 <条件> ? <表达式> : <表达式>
+	p.registerInfix(token.QUESTION, p.parseTernaryExpression)
+	// 自增自减 <标识符>++ <标识符>--
+	p.registerPostfix(token.INCREMENT, p.parsePostfixExpression)
+	p.registerPostfix(token.DECREMENT, p.parsePostfixExpression)
 	// 函数调用 <FunctionLiteral>(...) 所以为(注册中缀解析
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	// 索引调用 <ArrayLiteral>[...]
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	// 成员访问 <表达式>.<标识符>
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 	// 读2次，给cur和peek赋初始值
 	// 1. cur变为nil peek变为头
 	// 2. cur变为头 peek变为下一个
@@ -101,11 +158,16 @@ func (p *Parser) ParseProgram() *ast.Program {
 	program.Statements = []ast.Statement{}
 	// 反复读取直到结尾
 	for p.curToken.Type != token.EOF {
+		errCount := len(p.errors)
 		// 解析表达式
 		stmt := p.parseStatement()
-		// 如果能解析出表达式
-		if stmt != nil {
-			// 那把它放进program的集合里
+		if len(p.errors) > errCount {
+			// 一条语句只保留第一个错误，后面的多半是连带出来的
+			p.errors = p.errors[:errCount+1]
+			// 跳过这条出错语句剩下的token，从下一条语句继续解析
+			p.synchronize()
+		} else if stmt != nil {
+			// 如果能解析出表达式，那把它放进program的集合里
 			program.Statements = append(program.Statements, stmt)
 		}
 		// 下一个
@@ -114,12 +176,28 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
+// synchronize 出错后推进到分号，或者推进到下一个token是语句开头的关键字为止
+func (p *Parser) synchronize() {
+	for !p.curTokenIs(token.SEMICOLON) && !p.curTokenIs(token.EOF) {
+		if statementStarts[p.peekToken.Type] {
+			return
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
+	case token.CONST:
+		return p.parseConstStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.DEFER:
+		return p.parseDeferStatement()
+	case token.FOR:
+		return p.parseForInStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -149,8 +227,36 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	stmt := &ast.ConstStatement{Token: p.curToken}
+	// 和let一样，const <标识符> = <表达式>
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{
+		Token: p.curToken,
+		Value: p.curToken.Literal,
+	}
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
+	if p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF) {
+		// 没有返回值的return，ReturnValue保持nil
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	}
 	// 当前是return，推进下一个
 	p.nextToken()
 	// 表达式
@@ -161,6 +267,17 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+func (p *Parser) parseDeferStatement() *ast.DeferStatement {
+	stmt := &ast.DeferStatement{Token: p.curToken}
+	// 当前是defer，推进到表达式
+	p.nextToken()
+	stmt.Expression = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -179,6 +296,11 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExpr := prefix()
 	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+		if postfix := p.postfixParseFns[p.peekToken.Type]; postfix != nil {
+			p.nextToken()
+			leftExpr = postfix(leftExpr)
+			continue
+		}
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExpr
@@ -195,16 +317,47 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	literal, ok := p.stripUnderscores()
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseInt(literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("无法解析 %q 为数字", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, msg)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
+	literal, ok := p.stripUnderscores()
+	if !ok {
+		return nil
+	}
+	value, err := strconv.ParseFloat(literal, 64)
+	if err != nil {
+		msg := fmt.Sprintf("无法解析 %q 为小数", p.curToken.Literal)
+		p.addError(p.curToken, msg)
+		return nil
+	}
+	lit.Value = value
+	return lit
+}
+
+// stripUnderscores 去掉数字里作为分隔符的下划线，下划线只能出现在两个数字之间
+func (p *Parser) stripUnderscores() (string, bool) {
+	literal := p.curToken.Literal
+	if strings.HasPrefix(literal, "_") || strings.Contains(literal, "__") || strings.HasSuffix(literal, "_") || strings.Contains(literal, "_.") || strings.Contains(literal, "._") {
+		msg := fmt.Sprintf("数字中的下划线位置不正确: %q", literal)
+		p.addError(p.curToken, msg)
+		return "", false
+	}
+	return strings.ReplaceAll(literal, "_", ""), true
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -225,6 +378,15 @@ func (p *Parser) parseIndexExpression(leftExpr ast.Expression) ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseMemberExpression(leftExpr ast.Expression) ast.Expression {
+	expr := &ast.MemberExpression{Token: p.curToken, Object: leftExpr}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	expr.Property = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return expr
+}
+
 func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	args := make([]ast.Expression, 0)
 	if p.peekTokenIs(end) {
@@ -237,6 +399,10 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	for p.peekTokenIs(token.COMMA) {
 		// 跳过前一个表达式参数
 		p.nextToken()
+		if p.peekTokenIs(end) {
+			// 允许结尾多一个逗号，比如 [1, 2,]
+			break
+		}
 		// 跳过逗号
 		p.nextToken()
 		args = append(args, p.parseExpression(LOWEST))
@@ -251,6 +417,10 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
+func (p *Parser) parseNull() ast.Expression {
+	return &ast.Null{Token: p.curToken}
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	// 跳过当前(
 	p.nextToken()
@@ -294,6 +464,51 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expr
 }
 
+func (p *Parser) parseWhileExpression() ast.Expression {
+	expr := &ast.WhileExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		// 当前是WHILE，下一位不是(
+		return nil
+	}
+	p.nextToken()
+	expr.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	expr.Body = p.parseBlockStatement()
+	return expr
+}
+
+func (p *Parser) parseForInStatement() ast.Statement {
+	stmt := &ast.ForInStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseBlockStatement()
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{
 		Token: p.curToken,
@@ -304,7 +519,9 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 	// 解析参数
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 	if !p.expectPeek(token.LBRACE) {
 		// { 函数体开始
 		return nil
@@ -314,30 +531,67 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := make([]*ast.Identifier, 0)
+// parseFunctionParameters 解析参数列表，填充函数的参数、默认值和可变参数，出错时返回false
+// fn(a, b = 10) 有默认值的参数后面的参数也必须有默认值
+// fn(a, ...rest) 可变参数只能有一个且必须是最后一个
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = make([]*ast.Identifier, 0)
+	lit.Defaults = make([]ast.Expression, 0)
 	if p.peekTokenIs(token.RPAREN) {
 		// 无参，推进)
 		p.nextToken()
-		return identifiers
+		return true
 	}
-	// 当前是(，推进一位
-	p.nextToken()
-	first := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, first)
-	for p.peekTokenIs(token.COMMA) {
+	// 当前是(，每一轮开始时当前token是(或者前一个参数后面的逗号
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			next := p.peekToken
+			if p.peekTokenIs(token.COMMA) {
+				// 允许结尾多一个逗号
+				p.nextToken()
+			}
+			if !p.peekTokenIs(token.RPAREN) {
+				p.addError(next, fmt.Sprintf("可变参数 ...%s 必须是最后一个参数", lit.Rest.Value))
+				return false
+			}
+			break
+		}
+		if !p.expectPeek(token.IDENT) {
+			return false
+		}
+		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		var defaultValue ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			// 跳过参数名和=
+			p.nextToken()
+			p.nextToken()
+			defaultValue = p.parseExpression(LOWEST)
+			if defaultValue == nil {
+				return false
+			}
+		} else if len(lit.Defaults) > 0 && lit.Defaults[len(lit.Defaults)-1] != nil {
+			p.addError(p.curToken, fmt.Sprintf("参数 %s 必须有默认值，因为它前面的参数有默认值", ident.Value))
+			return false
+		}
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Defaults = append(lit.Defaults, defaultValue)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		// 跳过前一个参数
 		p.nextToken()
-		// 跳过逗号
-		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
-	if !p.expectPeek(token.RPAREN) {
-		// 没有)
-		return nil
+		if p.peekTokenIs(token.RPAREN) {
+			// 允许结尾多一个逗号，比如 fn(a, b,) {}
+			break
+		}
 	}
-	return identifiers
+	// 没有)
+	return p.expectPeek(token.RPAREN)
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -354,6 +608,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		// 循环的最后会把}推进掉
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.addError(p.curToken, fmt.Sprintf("期望下一个token是 %s，但是实际是 %s", token.RBRACE, token.EOF))
+	}
 	return block
 }
 
@@ -403,6 +660,74 @@ func (p *Parser) parseInfixExpression(leftExpr ast.Expression) ast.Expression {
 	return expr
 }
 
+// parseComparisonExpression 只有一个比较运算符时仍是普通的中缀表达式，
+// 后面紧跟着更多比较运算符时收集成ComparisonChain，加了括号的 (a < b) < c 不受影响
+func (p *Parser) parseComparisonExpression(leftExpr ast.Expression) ast.Expression {
+	expr := p.parseInfixExpression(leftExpr).(*ast.InfixExpression)
+	if !isComparison(p.peekToken.Type) {
+		return expr
+	}
+	chain := &ast.ComparisonChain{
+		Token:     expr.Token,
+		Operands:  []ast.Expression{expr.Left, expr.Right},
+		Operators: []string{expr.Operator},
+	}
+	for isComparison(p.peekToken.Type) {
+		p.nextToken()
+		chain.Operators = append(chain.Operators, p.curToken.Literal)
+		p.nextToken()
+		chain.Operands = append(chain.Operands, p.parseExpression(LESSGREATER))
+	}
+	return chain
+}
+
+func isComparison(t token.Type) bool {
+	return t == token.LT || t == token.GT || t == token.LTE || t == token.GTE
+}
+
+func (p *Parser) parseAssignExpression(leftExpr ast.Expression) ast.Expression {
+	name, ok := leftExpr.(*ast.Identifier)
+	if !ok {
+		if leftExpr == nil {
+			return nil
+		}
+		msg := fmt.Sprintf("无法赋值给 %s", leftExpr.String())
+		p.addError(p.curToken, msg)
+		return nil
+	}
+	expr := &ast.AssignExpression{Token: p.curToken, Name: name}
+	p.nextToken()
+	// 右结合 a = b = 1 等价于 a = (b = 1)
+	expr.Value = p.parseExpression(ASSIGN - 1)
+	return expr
+}
+
+// parsePostfixExpression 只有变量可以自增自减，当前token是++或--
+func (p *Parser) parsePostfixExpression(leftExpr ast.Expression) ast.Expression {
+	name, ok := leftExpr.(*ast.Identifier)
+	if !ok {
+		if leftExpr == nil {
+			return nil
+		}
+		p.addError(p.curToken, fmt.Sprintf("无法对 %s 使用 %s", leftExpr.String(), p.curToken.Literal))
+		return nil
+	}
+	return &ast.PostfixExpression{Token: p.curToken, Name: name, Operator: p.curToken.Literal}
+}
+
+func (p *Parser) parseTernaryExpression(condition ast.Expression) ast.Expression {
+	expr := &ast.TernaryExpression{Token: p.curToken, Condition: condition}
+	p.nextToken()
+	expr.Consequence = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	// 右结合 a ? b : c ? d : e 等价于 a ? b : (c ? d : e)
+	expr.Alternative = p.parseExpression(TERNARY - 1)
+	return expr
+}
+
 func (p *Parser) parseCallExpression(leftExpr ast.Expression) ast.Expression {
 	expr := &ast.CallExpression{Token: p.curToken, Function: leftExpr}
 	expr.Arguments = p.parseExpressionList(token.RPAREN)
@@ -434,7 +759,7 @@ func (p *Parser) Errors() []string {
 
 func (p *Parser) peekError(t token.Type) {
 	msg := fmt.Sprintf("期望下一个token是 %s，但是实际是 %s", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -453,7 +778,21 @@ func (p *Parser) curPrecedence() int {
 
 func (p *Parser) noPrefixParseFnError(t token.Type) {
 	msg := fmt.Sprintf("没有针对 %s 的前缀表达式解析函数", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, msg)
+}
+
+// addError 记录错误，并在前面加上出错token的位置
+func (p *Parser) addError(tok token.Token, msg string) {
+	if tok.Type == token.EOF {
+		p.unexpectedEOF = true
+	}
+	p.errors = append(p.errors, fmt.Sprintf("第%d行第%d列: %s", tok.Line, tok.Column, msg))
+}
+
+// UnexpectedEOF 是否有错误发生在输入结尾，也就是输入还没写完，比如缺少右括号
+// REPL用它判断是继续读取下一行还是直接报错
+func (p *Parser) UnexpectedEOF() bool {
+	return p.unexpectedEOF
 }
 
 func (p *Parser) registerPrefix(tokenType token.Type, fn prefixParseFn) {
@@ -463,3 +802,7 @@ func (p *Parser) registerPrefix(tokenType token.Type, fn prefixParseFn) {
 func (p *Parser) registerInfix(tokenType token.Type, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
+
+func (p *Parser) registerPostfix(tokenType token.Type, fn postfixParseFn) {
+	p.postfixParseFns[tokenType] = fn
+}
@@ -151,6 +151,8 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5;", "~", 5},
+		{"~foobar;", "~", "foobar"},
 	}
 
 	for _, tt := range prefixTests {
@@ -289,6 +291,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
 		},
+		{
+			"a + 1 <= b == c >= d * 2",
+			"(((a + 1) <= b) == (c >= (d * 2)))",
+		},
+		{
+			"a > b ? a : b",
+			"((a > b) ? a : b)",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"x = a ? b + 1 : c * 2",
+			"x = (a ? (b + 1) : (c * 2))",
+		},
 		{
 			"true",
 			"true",
@@ -349,6 +367,66 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"1 | 2 & 3",
+			"(1 | (2 & 3))",
+		},
+		{
+			"a ^ b | c & d ^ e",
+			"((a ^ b) | ((c & d) ^ e))",
+		},
+		{
+			"x & 1 == 0",
+			"(x & (1 == 0))",
+		},
+		{
+			"1 << 2 + 1",
+			"((1 << 2) + 1)",
+		},
+		{
+			"a * b >> c - d",
+			"(((a * b) >> c) - d)",
+		},
+		{
+			"a < b << c",
+			"(a < (b << c))",
+		},
+		{
+			"~a & ~-b",
+			"((~a) & (~(-b)))",
+		},
+		{
+			"a.b.c + d.e(1)[0]",
+			"(((a.b).c) + ((d.e)(1)[0]))",
+		},
+		{
+			"-h.x * 2",
+			"((-(h.x)) * 2)",
+		},
+		{
+			"-i++ * 2",
+			"((-(i++)) * 2)",
+		},
+		{
+			"a + i-- - b",
+			"((a + (i--)) - b)",
+		},
+		{
+			"5--3",
+			"(5 - (-3))",
+		},
+		{
+			"--5",
+			"(-(-5))",
+		},
+		{
+			"x--1",
+			"(x - (-1))",
+		},
+		{
+			"a * x--1",
+			"((a * x) - (-1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -988,3 +1066,763 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestWhileExpression(t *testing.T) {
+	input := `while (x < y) { x = x + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.WhileExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.WhileExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Body.Statements) != 1 {
+		t.Fatalf("body is not 1 statements. got=%d\n",
+			len(exp.Body.Statements))
+	}
+
+	body, ok := exp.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Body.Statements[0])
+	}
+
+	assign, ok := body.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("body.Expression is not ast.AssignExpression. got=%T",
+			body.Expression)
+	}
+
+	if !testIdentifier(t, assign.Name, "x") {
+		return
+	}
+
+	testInfixExpression(t, assign.Value, "x", "+", 1)
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5", "x = 5"},
+		{"x = y = 5", "x = y = 5"},
+		{"x = 1 + 2 * 3", "x = (1 + (2 * 3))"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		actual := program.String()
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	l := lexer.New("1 = 2")
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 parser error. got=%d (%v)", len(p.Errors()), p.Errors())
+	}
+}
+
+func TestDeferStatement(t *testing.T) {
+	input := `defer cleanup(x);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.DeferStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.DeferStatement. got=%T", program.Statements[0])
+	}
+	if stmt.TokenLiteral() != "defer" {
+		t.Fatalf("stmt.TokenLiteral not 'defer', got %q", stmt.TokenLiteral())
+	}
+	if stmt.Expression.String() != "cleanup(x)" {
+		t.Errorf("stmt.Expression wrong. got=%q", stmt.Expression.String())
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1;\nlet y 2;", "第2行第7列: 期望下一个token是 =，但是实际是 INT"},
+		{"let a = 1;\n\n  let = 5;", "第3行第7列: 期望下一个token是 IDENT，但是实际是 ="},
+		{"1 +\n    ;", "第2行第5列: 没有针对 ; 的前缀表达式解析函数"},
+		{"let big = 99999999999999999999;", "第1行第11列: 无法解析 \"99999999999999999999\" 为数字"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Errorf("expected parser errors for %q", tt.input)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+		expectedLast  string
+	}{
+		{
+			"let a = 1;\nlet b 2 3;\nlet c = 3;",
+			"第2行第7列: 期望下一个token是 =，但是实际是 INT",
+			"let c = 3;",
+		},
+		{
+			"let a = 1;\nlet b = (1 + ;\nlet c = 3;",
+			"第2行第14列: 没有针对 ; 的前缀表达式解析函数",
+			"let c = 3;",
+		},
+		{
+			"let a = 1;\nlet 5 6 7\nreturn a;",
+			"第2行第5列: 期望下一个token是 IDENT，但是实际是 INT",
+			"return a;",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected exactly 1 error. got=%d (%q)", len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expectedError, errors[0])
+		}
+
+		if len(program.Statements) != 2 {
+			t.Errorf("program.Statements does not contain 2 statements. got=%d (%q)",
+				len(program.Statements), program.String())
+			continue
+		}
+		if program.Statements[0].String() != "let a = 1;" {
+			t.Errorf("first statement wrong. got=%q", program.Statements[0].String())
+		}
+		if program.Statements[1].String() != tt.expectedLast {
+			t.Errorf("last statement wrong. want=%q, got=%q",
+				tt.expectedLast, program.Statements[1].String())
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	input := `const limit = 10;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+	if stmt.Name.Value != "limit" {
+		t.Errorf("stmt.Name.Value not 'limit'. got=%s", stmt.Name.Value)
+	}
+	testLiteralExpression(t, stmt.Value, 10)
+	if stmt.String() != "const limit = 10;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestNullExpression(t *testing.T) {
+	input := "let x = null; x == null;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	if _, ok := letStmt.Value.(*ast.Null); !ok {
+		t.Fatalf("letStmt.Value not *ast.Null. got=%T", letStmt.Value)
+	}
+
+	if program.Statements[1].String() != "(x == null)" {
+		t.Errorf("wrong String(). got=%q", program.Statements[1].String())
+	}
+}
+
+func TestInvalidRadixLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0xZZ", "第1行第1列: 无法解析 \"0xZZ\" 为数字"},
+		{"let x = 0b102;", "第1行第9列: 无法解析 \"0b102\" 为数字"},
+		{"0o8", "第1行第1列: 无法解析 \"0o8\" 为数字"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q. got=%d (%q)", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestIntegerLiteralUnderscores(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"1_000_000", 1000000},
+		{"1_0", 10},
+		{"0xFF_FF", 65535},
+		{"0b1010_1010", 170},
+	}
+
+	for _, tt := range tests {
+		program := New(lexer.New(tt.input)).ParseProgram()
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		integ, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+		}
+		if integ.Value != tt.expected {
+			t.Errorf("integ.Value not %d. got=%d", tt.expected, integ.Value)
+		}
+	}
+}
+
+func TestInvalidIntegerLiteralUnderscores(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"100_", "第1行第1列: 数字中的下划线位置不正确: \"100_\""},
+		{"1__0", "第1行第1列: 数字中的下划线位置不正确: \"1__0\""},
+		{"let x = 1_000__000;", "第1行第9列: 数字中的下划线位置不正确: \"1_000__000\""},
+		{"_100", "第1行第1列: 数字中的下划线位置不正确: \"_100\""},
+		{"__1_0", "第1行第1列: 数字中的下划线位置不正确: \"__1_0\""},
+		{"1 + _5", "第1行第5列: 数字中的下划线位置不正确: \"_5\""},
+		{"_1.5", "第1行第1列: 数字中的下划线位置不正确: \"_1.5\""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Errorf("expected 1 parser error for %q. got=%d (%q)", tt.input, len(errors), errors)
+			continue
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+
+	// 后面不是数字的下划线仍然是标识符
+	p := New(lexer.New("_x; _"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	testIdentifier(t, program.Statements[0].(*ast.ExpressionStatement).Expression, "_x")
+	testIdentifier(t, program.Statements[1].(*ast.ExpressionStatement).Expression, "_")
+}
+
+func TestFunctionParameterDefaults(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedParams   []string
+		expectedDefaults []string
+	}{
+		{"fn(a, b = 10) {};", []string{"a", "b"}, []string{"", "10"}},
+		{"fn(a = 1, b = a * 2) {};", []string{"a", "b"}, []string{"1", "(a * 2)"}},
+		{"fn(x) {};", []string{"x"}, []string{""}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) || len(function.Defaults) != len(tt.expectedParams) {
+			t.Fatalf("parameters or defaults length wrong. want %d, got=%d, %d",
+				len(tt.expectedParams), len(function.Parameters), len(function.Defaults))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+			def := function.Defaults[i]
+			if tt.expectedDefaults[i] == "" {
+				if def != nil {
+					t.Errorf("parameter %s should have no default. got=%s", ident, def.String())
+				}
+				continue
+			}
+			if def == nil || def.String() != tt.expectedDefaults[i] {
+				t.Errorf("default of %s wrong. want=%s, got=%v", ident, tt.expectedDefaults[i], def)
+			}
+		}
+	}
+
+	p := New(lexer.New("fn(a = 1, b) { b };"))
+	p.ParseProgram()
+	errors := p.Errors()
+	expected := "第1行第11列: 参数 b 必须有默认值，因为它前面的参数有默认值"
+	if len(errors) == 0 || errors[0] != expected {
+		t.Errorf("wrong errors. want first=%q, got=%q", expected, errors)
+	}
+}
+
+func TestVariadicParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedRest   string
+		expectedString string
+	}{
+		{"fn(...args) {};", []string{}, "args", "fn(...args)"},
+		{"fn(first, ...rest) {};", []string{"first"}, "rest", "fn(first, ...rest)"},
+		{"fn(a, b = 1, ...rest) {};", []string{"a", "b"}, "rest", "fn(a, b = 1, ...rest)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Fatalf("length parameters wrong. want %d, got=%d", len(tt.expectedParams), len(function.Parameters))
+		}
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+		if function.Rest == nil {
+			t.Fatalf("function.Rest is nil")
+		}
+		testIdentifier(t, function.Rest, tt.expectedRest)
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(...rest, a) {};", "第1行第11列: 可变参数 ...rest 必须是最后一个参数"},
+		{"fn(...) {};", "第1行第7列: 期望下一个token是 IDENT，但是实际是 )"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestTernaryExpression(t *testing.T) {
+	input := `x < y ? x : y`
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.TernaryExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.TernaryExpression. got=%T", stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	testIdentifier(t, exp.Consequence, "x")
+	testIdentifier(t, exp.Alternative, "y")
+
+	p = New(lexer.New("a ? b c"))
+	p.ParseProgram()
+	expected := "第1行第7列: 期望下一个token是 :，但是实际是 IDENT"
+	if len(p.Errors()) == 0 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. want first=%q, got=%q", expected, p.Errors())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"0.5", 0.5},
+		{"1_000.000_1", 1000.0001},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+
+	p := New(lexer.New("1_.5"))
+	p.ParseProgram()
+	expected := "第1行第1列: 数字中的下划线位置不正确: \"1_.5\""
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. want=%q, got=%q", expected, p.Errors())
+	}
+}
+
+func TestUnexpectedEOF(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"fn(x) {", true},
+		{"let x = (1 + ", true},
+		{"[1, 2", true},
+		{"if (x) { 1 } else {", true},
+		{"let x = 1;", false},
+		{"let = 1;", false},
+		{"let x = 1 +", true},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if p.UnexpectedEOF() != tt.expected {
+			t.Errorf("UnexpectedEOF() for %q wrong. want=%t, got=%t (errors=%q)",
+				tt.input, tt.expected, p.UnexpectedEOF(), p.Errors())
+		}
+	}
+}
+
+func TestTrailingCommas(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2, 3,]", "[1, 2, 3]"},
+		{"[1,]", "[1]"},
+		{"add(1, 2,)", "add(1, 2)"},
+		{"add(\n  1,\n  2,\n)", "add(1, 2)"},
+		{"fn(a, b,) {}", "fn(a, b)"},
+		{"fn(a, b = 1,) {}", "fn(a, b = 1)"},
+		{"fn(a, ...rest,) {}", "fn(a, ...rest)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1,, 2]", "第1行第4列: 没有针对 , 的前缀表达式解析函数"},
+		{"[1, 2,,]", "第1行第7列: 没有针对 , 的前缀表达式解析函数"},
+		{"add(1,,)", "第1行第7列: 没有针对 , 的前缀表达式解析函数"},
+		{"fn(a,,) {}", "第1行第6列: 期望下一个token是 IDENT，但是实际是 ,"},
+		{"fn(,) {}", "第1行第4列: 期望下一个token是 IDENT，但是实际是 ,"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestBareReturnStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return;", "return;"},
+		{"return", "return;"},
+		{"fn() { if (true) { return; } 5 }", "fn()iftrue return;5"},
+		{"fn() { return }", "fn()return;"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("return;"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.ReturnStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
+	}
+	if stmt.ReturnValue != nil {
+		t.Errorf("stmt.ReturnValue is not nil. got=%s", stmt.ReturnValue)
+	}
+}
+
+func TestMemberExpression(t *testing.T) {
+	p := New(lexer.New("user.name"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	member, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.MemberExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, member.Object, "user") {
+		return
+	}
+	testIdentifier(t, member.Property, "name")
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"user.", "第1行第6列: 期望下一个token是 IDENT，但是实际是 EOF"},
+		{"user.1", "第1行第6列: 期望下一个token是 IDENT，但是实际是 INT"},
+		{`user."name"`, "第1行第6列: 期望下一个token是 IDENT，但是实际是 STRING"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestPostfixExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		operator string
+	}{
+		{"i++;", "i", "++"},
+		{"count--", "count", "--"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.PostfixExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.PostfixExpression. got=%T", stmt.Expression)
+		}
+		if !testIdentifier(t, exp.Name, tt.name) {
+			return
+		}
+		if exp.Operator != tt.operator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.operator, exp.Operator)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"a.b++", "第1行第4列: 无法对 (a.b) 使用 ++"},
+		{"a[0].b--", "第1行第7列: 无法对 ((a[0]).b) 使用 --"},
+		// 不在标识符后面的++是两个加号
+		{"5++", "第1行第3列: 没有针对 + 的前缀表达式解析函数"},
+		{"x++1", "第1行第3列: 没有针对 + 的前缀表达式解析函数"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	p := New(lexer.New(`for (x in [1, 2]) { puts(x); }; x`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+	if !testIdentifier(t, stmt.Variable, "x") {
+		return
+	}
+	if stmt.Iterable.String() != "[1, 2]" {
+		t.Errorf("stmt.Iterable wrong. got=%q", stmt.Iterable.String())
+	}
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("body does not contain 1 statement. got=%d", len(stmt.Body.Statements))
+	}
+	if stmt.Body.String() != "puts(x)" {
+		t.Errorf("body wrong. got=%q", stmt.Body.String())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"for x in xs {}", "第1行第5列: 期望下一个token是 (，但是实际是 IDENT"},
+		{"for (1 in xs) {}", "第1行第6列: 期望下一个token是 IDENT，但是实际是 INT"},
+		{"for (x of xs) {}", "第1行第8列: 期望下一个token是 IN，但是实际是 IDENT"},
+		{"for (x in xs) puts(x)", "第1行第15列: 期望下一个token是 {，但是实际是 IDENT"},
+	}
+	for _, tt := range errorTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestComparisonChain(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  string
+		operators []string
+	}{
+		{"1 < 2 < 3", "(1 < 2 < 3)", []string{"<", "<"}},
+		{"a <= b + 1 > c >= d", "(a <= (b + 1) > c >= d)", []string{"<=", ">", ">="}},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		chain, ok := stmt.Expression.(*ast.ComparisonChain)
+		if !ok {
+			t.Fatalf("exp not *ast.ComparisonChain. got=%T", stmt.Expression)
+		}
+		if chain.String() != tt.expected {
+			t.Errorf("chain.String() wrong. want=%q, got=%q", tt.expected, chain.String())
+		}
+		if len(chain.Operands) != len(tt.operators)+1 {
+			t.Fatalf("chain.Operands length wrong. got=%d", len(chain.Operands))
+		}
+		for i, op := range tt.operators {
+			if chain.Operators[i] != op {
+				t.Errorf("chain.Operators[%d] is not %q. got=%q", i, op, chain.Operators[i])
+			}
+		}
+	}
+
+	// 单个比较、加了括号以及相等比较都不会组成连续比较
+	others := []struct {
+		input    string
+		expected string
+	}{
+		{"1 < 2", "(1 < 2)"},
+		{"(1 < 2) < 3", "((1 < 2) < 3)"},
+		{"a < b == c < d", "((a < b) == (c < d))"},
+		{"a == b == c", "((a == b) == c)"},
+	}
+	for _, tt := range others {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		if _, ok := stmt.Expression.(*ast.ComparisonChain); ok {
+			t.Errorf("%q should not parse as *ast.ComparisonChain", tt.input)
+		}
+		if stmt.Expression.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, stmt.Expression.String())
+		}
+	}
+}
@@ -2,41 +2,118 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
+	"interpreter/ast"
 	"interpreter/evaluator"
 	"interpreter/lexer"
 	"interpreter/object"
 	"interpreter/parser"
 	"io"
+	"strings"
 )
 
-const PROMPT = ">> "
+const (
+	PROMPT          = ">> "
+	CONTINUE_PROMPT = ".. "    // 输入还没写完时的提示符
+	RESET_COMMAND   = ":reset" // 清空之前定义的所有变量
+)
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	// 整个会话共用一个Evaluator，puts、print的输出和结果写到同一个out
+	e := evaluator.New()
+	e.Output = out
+	// 跨行的输入先攒起来，直到能完整解析或者确定有语法错误
+	var pending []string
 	for {
-		fmt.Printf(PROMPT)
+		if len(pending) == 0 {
+			_, _ = io.WriteString(out, PROMPT)
+		} else {
+			_, _ = io.WriteString(out, CONTINUE_PROMPT)
+		}
 		scanned := scanner.Scan()
 		if !scanned {
+			if len(pending) > 0 {
+				// 输入结束了语句还没写完，把错误打印出来
+				p := parser.New(lexer.New(strings.Join(pending, "\n")))
+				p.ParseProgram()
+				printParserErrors(out, p.Errors())
+			}
 			return
 		}
 		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		if len(pending) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(pending) == 0 && strings.TrimSpace(line) == RESET_COMMAND {
+			env = object.NewEnvironment()
+			continue
+		}
+		pending = append(pending, line)
+		p := parser.New(lexer.New(strings.Join(pending, "\n")))
 		program := p.ParseProgram()
+		if len(p.Errors()) > 0 && p.UnexpectedEOF() {
+			// 缺少右括号之类的，继续读取下一行
+			continue
+		}
+		pending = nil
 		if len(p.Errors()) > 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			_, _ = io.WriteString(out, evaluated.Inspect())
+		evaluated := e.Eval(program, env)
+		if _, ok := evaluated.(*object.Exit); ok {
+			// 调用了exit()，结束REPL
+			return
+		}
+		if shouldPrint(program, evaluated) {
+			_, _ = io.WriteString(out, inspectResult(evaluated))
 			_, _ = io.WriteString(out, "\n")
 		}
 	}
 }
 
+// shouldPrint 错误总是打印，其余的只有最后一条是表达式语句且结果不是null时才打印
+// let定义和puts这类没有返回值的调用不会多打印一行null
+func shouldPrint(program *ast.Program, evaluated object.Object) bool {
+	if evaluated == nil {
+		return false
+	}
+	if evaluated.Type() == object.ERROR_OBJ {
+		return true
+	}
+	if len(program.Statements) == 0 {
+		return false
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); !ok {
+		return false
+	}
+	return evaluated.Type() != object.NULL_OBJ
+}
+
+// inspectResult 字符串结果显示成带引号的转义形式，避免和换行、数字等混淆
+// 数组和哈希里的字符串同样加引号，其余格式与Inspect一致
+func inspectResult(evaluated object.Object) string {
+	switch obj := evaluated.(type) {
+	case *object.String:
+		return obj.InspectQuoted()
+	case *object.Array:
+		elements := make([]string, 0, len(obj.Elements))
+		for _, el := range obj.Elements {
+			elements = append(elements, inspectResult(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *object.Hash:
+		pairs := make([]string, 0, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, inspectResult(pair.Key)+": "+inspectResult(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	default:
+		return evaluated.Inspect()
+	}
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		_, _ = io.WriteString(out, "\t"+msg+"\n")
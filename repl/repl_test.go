@@ -0,0 +1,126 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func run(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+add(1,
+  2)
+`
+	expected := ">> .. .. .. " +
+		">> .. 3\n" +
+		">> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestMultiLineStructures(t *testing.T) {
+	input := `let h = {
+"a": [1,
+2]
+};
+h["a"][1]
+if (true) {
+  10
+} else {
+  20
+}
+`
+	got := run(input)
+	if !strings.Contains(got, ">> 2\n") {
+		t.Errorf("hash across lines not evaluated. got=%q", got)
+	}
+	if !strings.HasSuffix(got, ".. .. .. 10\n>> ") {
+		t.Errorf("if across lines not evaluated. got=%q", got)
+	}
+}
+
+func TestBrokenInputReportedImmediately(t *testing.T) {
+	// 不是因为输入没写完的错误直接打印，不会继续等待下一行
+	input := "let = 1;\n1 + 1\n"
+	expected := ">> \t第1行第5列: 期望下一个token是 IDENT，但是实际是 =\n>> 2\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestIncompleteInputAtEnd(t *testing.T) {
+	input := "let f = fn(x) {\nx\n"
+	expected := ">> .. .. \t第2行第2列: 期望下一个token是 }，但是实际是 EOF\n"
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestEnvironmentPersistsAcrossInputs(t *testing.T) {
+	input := "let x = 1\nx + 1\nlet double = fn(n) { n * 2 };\ndouble(x + 4)\n"
+	expected := ">> >> 2\n>> >> 10\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestResetCommand(t *testing.T) {
+	input := "let x = 1\n:reset\nx\nlet x = 5; x\n"
+	expected := ">> >> >> ERROR: 第1行: 变量未定义: x\n>> 5\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestNullResultsNotPrinted(t *testing.T) {
+	input := "if (false) { 1 }\nnull\nlet y = 2\ny; let z = 3;\n[null]\n"
+	expected := ">> >> >> >> >> [null]\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestExitStopsREPL(t *testing.T) {
+	input := "1\nexit()\n2\n"
+	expected := ">> 1\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestStringResultsQuoted(t *testing.T) {
+	// puts仍然打印原始内容，和结果写到同一个输出
+	input := "\"12\"\nlet s = \"a\" + chr(10) + \"b\"\ns\nputs(s)\n"
+	expected := ">> \"12\"\n>> >> \"a\\nb\"\n>> a\nb\n>> "
+	if got := run(input); got != expected {
+		t.Errorf("output wrong.\nwant=%q\ngot= %q", expected, got)
+	}
+}
+
+func TestNestedStringResultsQuoted(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[\"a\" + chr(10) + \"b\", 1]\n", ">> [\"a\\nb\", 1]\n>> "},
+		{"[\"1\", 1, [\"x\"], []]\n", ">> [\"1\", 1, [\"x\"], []]\n>> "},
+		{"{\"k\": \"x\"}\n", ">> {\"k\": \"x\"}\n>> "},
+		{"{1: [\"a, b\"]}\n", ">> {1: [\"a, b\"]}\n>> "},
+		{"{}\n", ">> {}\n>> "},
+	}
+	for _, tt := range tests {
+		if got := run(tt.input); got != tt.expected {
+			t.Errorf("output wrong for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -5,6 +5,8 @@ type Type string
 type Token struct {
 	Type           // 类型
 	Literal string // 实际含义
+	Line    int    // 所在行，从1开始
+	Column  int    // 首字符所在列，从1开始
 }
 
 const (
@@ -13,18 +15,31 @@ const (
 	// IDENT 标识符
 	IDENT  = "IDENT" // 变量名，函数名
 	INT    = "INT"
+	FLOAT  = "FLOAT"
 	STRING = "STRING"
 	// ASSIGN 操作符
-	ASSIGN   = "="
-	PLUS     = "+"
-	MINUS    = "-"
-	ASTERISK = "*"
-	SLASH    = "/"
-	BANG     = "!"
-	LT       = "<"
-	GT       = ">"
-	EQ       = "=="
-	NEQ      = "!="
+	ASSIGN = "="
+	PLUS   = "+"
+	MINUS  = "-"
+	// INCREMENT 自增自减
+	INCREMENT = "++"
+	DECREMENT = "--"
+	ASTERISK  = "*"
+	SLASH     = "/"
+	BANG      = "!"
+	LT        = "<"
+	GT        = ">"
+	LTE       = "<="
+	GTE       = ">="
+	EQ        = "=="
+	NEQ       = "!="
+	// AMPERSAND 位运算
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	LSHIFT    = "<<"
+	RSHIFT    = ">>"
+	TILDE     = "~"
 	// COMMA 分隔符
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -35,6 +50,9 @@ const (
 	LBRACKET  = "["
 	RBRACKET  = "]"
 	COLON     = ":"
+	QUESTION  = "?"
+	DOT       = "."
+	ELLIPSIS  = "..."
 	// FUNCTION 关键词
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
@@ -43,6 +61,12 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	WHILE    = "WHILE"
+	DEFER    = "DEFER"
+	CONST    = "CONST"
+	NULL     = "NULL"
+	FOR      = "FOR"
+	IN       = "IN"
 )
 
 var Keywords = map[string]Type{
@@ -53,6 +77,12 @@ var Keywords = map[string]Type{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"while":  WHILE,
+	"defer":  DEFER,
+	"const":  CONST,
+	"null":   NULL,
+	"for":    FOR,
+	"in":     IN,
 }
 
 func LookupIdent(ident string) Type {